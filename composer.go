@@ -1,9 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/t12y/composer/composer"
 )
@@ -16,18 +19,54 @@ func main() {
 		composerFile = "composer.yml"
 	}
 
-	cfg, err := composer.ParseConfig(composerFile)
-	if err != nil {
-		fmt.Println("Cannot parse config:", err)
-		os.Exit(errCode)
+	// ctl and ps are reserved subcommands, services with such names can be run after "--" (i.e. composer -- ps)
+	if len(os.Args) > 1 && (os.Args[1] == "ctl" || os.Args[1] == "ps") {
+		cfg, err := composer.ParseConfig(composerFile)
+		if err != nil {
+			fmt.Println("Cannot parse config:", err)
+			os.Exit(errCode)
+		}
+
+		if os.Args[1] == "ps" {
+			os.Exit(ctl(*cfg, []string{composer.ControlStatus}))
+		}
+
+		os.Exit(ctl(*cfg, os.Args[2:]))
 	}
 
 	var waitForAll bool
 	flag.BoolVar(&waitForAll, "wait", false, "wait for all services to finish")
+
+	var maxParallel int
+	flag.IntVar(&maxParallel, "max-parallel", 0, "maximum number of services starting at the same time (0 means no limit)")
+
+	var parallelShutdown bool
+	flag.BoolVar(&parallelShutdown, "parallel-shutdown", false, "stop all services at once (instead of dependents first)")
+
+	var output string
+	flag.StringVar(&output, "output", string(composer.OutputText), "output format: text or json (one JSON object per line)")
+
+	var outputBuffer int
+	flag.IntVar(&outputBuffer, "output-buffer", composer.DefaultOutputBufferSize, "number of output lines buffered before they are printed")
+
+	var outputOverflow string
+	flag.StringVar(&outputOverflow, "output-overflow", string(composer.OverflowBlock), "what happens when the output buffer is full: block (services wait) or drop (lines are dropped)")
+
+	var timestamps, timestampFormat string
+	flag.StringVar(&timestamps, "timestamps", "", "prefix output lines with timestamps: wall (time of day) or elapsed (since composer started)")
+	flag.StringVar(&timestampFormat, "timestamp-format", composer.DefaultTimestampFormat, "layout of timestamps (see https://pkg.go.dev/time#pkg-constants)")
 	flag.Parse()
 
+	// errors are printed in the same format as the output (config is parsed once the format is known)
+	cfg, err := composer.ParseConfig(composerFile)
+	if err != nil {
+		printError(output, "Cannot parse config", err)
+		os.Exit(errCode)
+	}
+
 	if len(os.Args) <= 1 {
-		fmt.Printf("\nUsage: %s [options] SERVICE [SERVICE ...]\n\nOptions:\n", os.Args[0])
+		fmt.Printf("\nUsage: %s [options] SERVICE [SERVICE ...]\n       %s ps\n       %s ctl COMMAND [SERVICE]\n", os.Args[0], os.Args[0], os.Args[0])
+		fmt.Printf("\nServices named ps or ctl can be run after \"--\", i.e.: %s [options] -- ps\n\nOptions:\n", os.Args[0])
 		flag.PrintDefaults()
 
 		fmt.Println("\nServices:")
@@ -40,9 +79,21 @@ func main() {
 
 	services := flag.Args()
 
+	opts := []composer.Option{
+		composer.WithOutputFormat(composer.OutputFormat(output)),
+		composer.WithOutputBuffer(outputBuffer, composer.OverflowPolicy(outputOverflow)),
+		composer.WithTimestamps(composer.TimestampMode(timestamps), timestampFormat),
+		composer.WithMaxParallel(maxParallel),
+		composer.WithControlSocket(composer.SocketPath(*cfg)),
+	}
+
+	if parallelShutdown {
+		opts = append(opts, composer.WithParallelShutdown())
+	}
+
 	var c *composer.Composer
-	if c, err = composer.New(*cfg, services...); err != nil {
-		fmt.Println("Error initializing composer:", err)
+	if c, err = composer.New(*cfg, services, opts...); err != nil {
+		printError(output, "Error initializing composer", err)
 		os.Exit(errCode)
 	}
 
@@ -53,7 +104,41 @@ func main() {
 	}
 
 	if err != nil {
-		fmt.Println("Error running composer:", err)
-		os.Exit(errCode)
+		printError(output, "Error running composer", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// printError prints the error as a JSON record when the output format is JSON (so all lines of output can be parsed)
+func printError(output string, msg string, err error) {
+	if composer.OutputFormat(output) != composer.OutputJSON {
+		fmt.Printf("%s: %v\n", msg, err)
+		return
+	}
+
+	data, _ := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Level   string    `json:"level"`
+		Message string    `json:"message"`
+	}{Time: time.Now(), Level: "error", Message: fmt.Sprintf("%s: %v", msg, err)})
+
+	fmt.Println(string(data))
+}
+
+// exitCode returns the exit code of a service which made composer fail with err (or errCode)
+func exitCode(err error) int {
+	var exitErr *composer.ServiceExitError
+	if !errors.As(err, &exitErr) {
+		return errCode
+	}
+
+	switch {
+	case exitErr.Signal != 0:
+		// the same exit code as shells use for processes killed by a signal
+		return 128 + int(exitErr.Signal)
+	case exitErr.ExitCode > 0:
+		return exitErr.ExitCode
+	default:
+		return errCode
 	}
 }
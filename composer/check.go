@@ -0,0 +1,346 @@
+package composer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// check is a single attempt to determine whether a service is ready or healthy
+type check interface {
+	run(ctx context.Context) error
+}
+
+type readyCheck struct {
+	check    check
+	interval time.Duration
+	timeout  time.Duration
+	attempts int
+}
+
+func newReadyCheck(service *Service, cfg *ReadyCheck) (*readyCheck, error) {
+	rc := &readyCheck{
+		interval: cfg.Interval,
+		timeout:  cfg.Timeout,
+		attempts: cfg.Attempts,
+	}
+
+	if rc.interval == 0 {
+		rc.interval = DefaultCheckInterval
+	}
+
+	if rc.timeout == 0 {
+		rc.timeout = DefaultCheckTimeout
+	}
+
+	var err error
+	if rc.check, err = newCheck(service, cfg.Check); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+type livenessCheck struct {
+	check            check
+	period           time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	onFailure        LivenessAction
+}
+
+func newLivenessCheck(service *Service, cfg *LivenessCheck) (*livenessCheck, error) {
+	lc := &livenessCheck{
+		period:           cfg.Period,
+		timeout:          cfg.Timeout,
+		failureThreshold: cfg.FailureThreshold,
+		onFailure:        cfg.OnFailure,
+	}
+
+	if lc.period == 0 {
+		lc.period = DefaultLivenessCheckPeriod
+	}
+
+	if lc.timeout == 0 {
+		lc.timeout = DefaultCheckTimeout
+	}
+
+	if lc.failureThreshold == 0 {
+		lc.failureThreshold = DefaultLivenessCheckFailureThreshold
+	}
+
+	switch lc.onFailure {
+	case "":
+		lc.onFailure = LivenessRestart
+	case LivenessRestart, LivenessAbort:
+	default:
+		return nil, fmt.Errorf("unknown on_failure action: %s", lc.onFailure)
+	}
+
+	var err error
+	if lc.check, err = newCheck(service, cfg.Check); err != nil {
+		return nil, err
+	}
+
+	return lc, nil
+}
+
+func newCheck(service *Service, cfg Check) (check, error) {
+	var result check
+	checks := 0
+
+	if cfg.HTTP != nil {
+		httpCheck, err := newHTTPCheck(service, cfg.HTTP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http check: %w", err)
+		}
+		result = httpCheck
+		checks++
+	}
+
+	if cfg.TCP != "" {
+		result = &dialCheck{service: service, network: "tcp", address: cfg.TCP}
+		checks++
+	}
+
+	if cfg.Unix != "" {
+		result = &dialCheck{service: service, network: "unix", address: cfg.Unix}
+		checks++
+	}
+
+	if cfg.Command != "" {
+		result = &commandCheck{service: service, command: cfg.Command}
+		checks++
+	}
+
+	if checks == 0 {
+		return nil, fmt.Errorf("check type required")
+	}
+
+	if checks > 1 {
+		return nil, fmt.Errorf("only one check type can be defined")
+	}
+
+	return result, nil
+}
+
+type httpCheck struct {
+	service *Service
+	// url is expanded with the service's environment when the check runs
+	url       string
+	minStatus int
+	maxStatus int
+}
+
+func newHTTPCheck(service *Service, cfg *HTTPCheck) (*httpCheck, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("url required")
+	}
+
+	c := &httpCheck{
+		service:   service,
+		url:       cfg.URL,
+		minStatus: cfg.MinStatus,
+		maxStatus: cfg.MaxStatus,
+	}
+
+	if c.minStatus == 0 {
+		c.minStatus = DefaultHTTPCheckMinStatus
+	}
+
+	if c.maxStatus == 0 {
+		c.maxStatus = DefaultHTTPCheckMaxStatus
+	}
+
+	if c.minStatus > c.maxStatus {
+		return nil, fmt.Errorf("min_status (%d) is greater than max_status (%d)", c.minStatus, c.maxStatus)
+	}
+
+	return c, nil
+}
+
+func (c *httpCheck) run(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.service.expand(c.url), nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < c.minStatus || resp.StatusCode > c.maxStatus {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// dialCheck succeeds when a connection to the address can be established
+type dialCheck struct {
+	service *Service
+	network string
+	// address is expanded with the service's environment when the check runs
+	address string
+}
+
+func (c *dialCheck) run(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, c.network, c.service.expand(c.address))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// commandCheck succeeds when the command exits with 0 exit code
+type commandCheck struct {
+	service *Service
+	command string
+}
+
+func (c *commandCheck) run(ctx context.Context) error {
+	return runCommand(ctx, c.service.newCmd(c.command))
+}
+
+// goCheck runs the check in a goroutine awaited by cleanup. Checks are not started once composer is stopping.
+func (c *Composer) goCheck(check func()) {
+	c.checksLock.Lock()
+	defer c.checksLock.Unlock()
+
+	if c.isStopping() {
+		return
+	}
+
+	c.checksWait.Add(1)
+	go func() {
+		defer c.checksWait.Done()
+		check()
+	}()
+}
+
+// runReadyCheck repeats the service's ready check until it succeeds, runs out of attempts or composer stops.
+// An error is returned only when the check runs out of attempts.
+func (c *Composer) runReadyCheck(service *Service) error {
+	rc := service.readyCheck
+
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+
+	for attempt := 1; ; attempt++ {
+		checkCtx, checkCancel := context.WithTimeout(ctx, rc.timeout)
+		err := rc.check.run(checkCtx)
+		checkCancel()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err == nil {
+			c.debug("ready check for %s succeeded", service.name)
+			service.markReady(nil)
+			return nil
+		}
+
+		c.debug("ready check for %s failed (attempt %d): %v", service.name, attempt, err)
+
+		if rc.attempts > 0 && attempt >= rc.attempts {
+			return fmt.Errorf("service %s not ready after %d check attempts: %w", service.name, attempt, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// recheckReady runs the ready check of the restarted service. When the check fails, the service is stopped
+// and its exit is handled with the check's error (like a crash, according to its restart policy).
+func (c *Composer) recheckReady(service *Service) {
+	err := c.runReadyCheck(service)
+	if err == nil {
+		return
+	}
+
+	c.serviceInfo(service, "%v", err)
+
+	service.lock.Lock()
+	service.readyErr = err
+	service.lock.Unlock()
+
+	c.stopService(service)
+}
+
+// runLivenessCheck periodically checks the ready service until it's done or composer stops.
+// When the check fails too many times in a row, the service is restarted or composer is stopped.
+// The service isn't checked while it's not ready (i.e. while it's restarting or stopped).
+func (c *Composer) runLivenessCheck(service *Service) {
+	lc := service.liveness
+
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	ticker := time.NewTicker(lc.period)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-service.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if service.currentState() != StateReady {
+			failures = 0
+			continue
+		}
+
+		checkCtx, checkCancel := context.WithTimeout(ctx, lc.timeout)
+		err := lc.check.run(checkCtx)
+		checkCancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		c.serviceInfo(service, "liveness check failed (%d/%d): %v", failures, lc.failureThreshold, err)
+
+		if failures < lc.failureThreshold {
+			continue
+		}
+
+		failures = 0
+
+		if lc.onFailure == LivenessAbort {
+			c.quit(service.name, fmt.Errorf("service %s is unhealthy: %w", service.name, err))
+			return
+		}
+
+		c.serviceInfo(service, "service is unhealthy, restarting")
+		c.forceRestart(service)
+	}
+}
@@ -2,10 +2,12 @@ package composer
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -13,19 +15,42 @@ import (
 )
 
 type Composer struct {
-	cfg          Config
-	waitFor      map[string]bool
-	waitLock     sync.Mutex
-	services     []*Service
-	running      map[string]bool
-	cleanupWait  sync.WaitGroup
-	outputWait   sync.WaitGroup
+	cfg         Config
+	waitFor     map[string]bool
+	waitLock    sync.Mutex
+	services    []*Service
+	running     map[string]bool
+	cleanupWait sync.WaitGroup
+	// checksWait waits for goroutines running ready and liveness checks (see goCheck),
+	// checksLock prevents starting them once cleanup closes stopping
+	checksWait   sync.WaitGroup
+	checksLock   sync.Mutex
+	topLevelWait sync.WaitGroup
 	lastError    chan error
+	stopping     chan struct{}
+	maxParallel  int
 	debugEnabled bool
+
+	parallelShutdown bool
+	socketPath       string
+	outputFormat     OutputFormat
+	timestamps       TimestampMode
+	timestampFormat  string
+	// startedAt is the time when composer started running (timestamps of output lines are relative to it)
+	startedAt time.Time
+	output    *outputMux
+
+	// stdout and stderr are writers of composer's output (os.Stdout and os.Stderr when not set)
+	stdout         io.Writer
+	stderr         io.Writer
+	signals        []os.Signal
+	openFilesLimit uint64
+
+	subscriptions *subscriptions
 }
 
-// New runs a service with all of its dependencies
-func New(cfg Config, initServices ...string) (*Composer, error) {
+// New prepares composer running the services with all of their dependencies
+func New(cfg Config, initServices []string, opts ...Option) (*Composer, error) {
 	servicesToStart, err := cfg.ServicesToStart(initServices...)
 	if err != nil {
 		return nil, fmt.Errorf("config error: %w", err)
@@ -39,19 +64,52 @@ func New(cfg Config, initServices ...string) (*Composer, error) {
 	services := make([]*Service, len(servicesToStart))
 
 	env := cfg.Environment
+	events := new(subscriptions)
 
 	for i, name := range servicesToStart {
-		if services[i], err = NewService(i, name, env, cfg.Services[name]); err != nil {
+		serviceCfg := cfg.Services[name]
+		if serviceCfg.ReadyTimeout == 0 {
+			serviceCfg.ReadyTimeout = cfg.ReadyTimeout
+		}
+
+		if serviceCfg.CollapseRepeats == "" {
+			serviceCfg.CollapseRepeats = cfg.CollapseRepeats
+		}
+
+		if services[i], err = NewService(i, name, env, serviceCfg); err != nil {
 			return nil, fmt.Errorf("error setting up service %s: %w", name, err)
 		}
 		services[i].isDependency = !topLevelServices[name]
+		services[i].events = events
+
+		logFile := serviceCfg.LogFile
+		if logFile == "" && cfg.LogDir != "" {
+			logFile = filepath.Join(cfg.LogDir, name+".log")
+		}
+
+		if logFile != "" {
+			services[i].logFile = newLogFile(logFile, cfg.LogMaxSize, cfg.LogMaxFiles)
+		}
 	}
 
 	composer := &Composer{
-		cfg:          cfg,
-		services:     services,
-		debugEnabled: os.Getenv("DEBUG") != "",
-		lastError:    make(chan error, len(servicesToStart)),
+		cfg:            cfg,
+		services:       services,
+		debugEnabled:   os.Getenv("DEBUG") != "",
+		lastError:      make(chan error, len(servicesToStart)+1),
+		stopping:       make(chan struct{}),
+		signals:        []os.Signal{os.Interrupt, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT},
+		openFilesLimit: DefaultOpenFilesLimit,
+	}
+
+	composer.subscriptions = events
+	composer.output = newOutputMux(composer.droppedNotice)
+	composer.setLogPrefixes()
+
+	for _, opt := range opts {
+		if err = opt(composer); err != nil {
+			return nil, err
+		}
 	}
 
 	return composer, nil
@@ -59,26 +117,81 @@ func New(cfg Config, initServices ...string) (*Composer, error) {
 
 // Run starts all services
 func (c *Composer) Run() error {
-	c.info("Preparing composer")
+	return c.RunContext(context.Background())
+}
+
+// RunContext starts all services, cancelling the context interrupts composer (the same way as Interrupt,
+// but the context's error is returned instead of ErrInterrupted)
+func (c *Composer) RunContext(ctx context.Context) error {
+	runDone := make(chan struct{})
+	defer close(runDone)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.info("Interrupting composer...")
+			c.lastError <- ctx.Err()
+		case <-runDone:
+		}
+	}()
 
-	const maxOpenFiles = 65000
-	opeFilesRLimit := &syscall.Rlimit{
-		Cur: maxOpenFiles,
-		Max: maxOpenFiles,
+	if c.output.sinks == nil {
+		c.output.sinks = c.defaultSinks()
 	}
 
-	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, opeFilesRLimit); err != nil {
-		return fmt.Errorf("error setting system limits: %w", err)
+	// subscribers are closed once all events are delivered
+	defer c.subscriptions.close()
+
+	c.output.start()
+	defer c.output.stop()
+
+	defer c.shutdownCompleted()
+
+	c.startedAt = time.Now()
+	c.info("Preparing composer")
+
+	if c.openFilesLimit > 0 {
+		if err := setOpenFilesLimit(c.openFilesLimit); err != nil {
+			return fmt.Errorf("error setting system limits: %w", err)
+		}
 	}
 
 	if err := c.prepareServices(); err != nil {
 		return fmt.Errorf("error preparing services: %w", err)
 	}
 
-	defer c.cleanup()
+	defer c.closeLogFiles()
+	if err := c.openLogFiles(); err != nil {
+		return err
+	}
+
+	if err := c.runGlobalHook("before_all", c.cfg.BeforeAll); err != nil {
+		return err
+	}
+
+	if c.socketPath != "" {
+		listener, err := c.listenControlSocket()
+		if err != nil {
+			c.info("Control socket disabled: %v", err)
+		} else {
+			defer func() { _ = listener.Close() }()
+		}
+	}
+
+	// signals are handled until all services are stopped, so composer isn't killed while cleaning up
+	signalCh := c.notifySignals()
+	defer signal.Stop(signalCh)
+
+	defer func() {
+		c.cleanup()
+
+		if err := c.runGlobalHook("after_all", c.cfg.AfterAll); err != nil {
+			c.info("%v", err)
+		}
+	}()
 
 	c.info("Starting services")
-	if err := c.startServices(); err != nil {
+	if err := c.startServices(signalCh); err != nil {
 		return err
 	}
 
@@ -96,10 +209,10 @@ func (c *Composer) RunAll(services ...string) error {
 	return c.Run()
 }
 
-// Interrupt interrupts composer execution
+// Interrupt interrupts composer execution (Run returns ErrInterrupted)
 func (c *Composer) Interrupt() {
 	c.info("Interrupting composer...")
-	c.lastError <- fmt.Errorf("interrupted by user")
+	c.lastError <- ErrInterrupted
 }
 
 // EnableDebug enables debug logging
@@ -107,6 +220,18 @@ func (c *Composer) EnableDebug() {
 	c.debugEnabled = true
 }
 
+// SetMaxParallel limits how many services can be starting (not ready yet) at the same time.
+// When set to 0 (default), all services with ready dependencies are started at once.
+func (c *Composer) SetMaxParallel(n int) {
+	c.maxParallel = n
+}
+
+// EnableParallelShutdown makes composer stop all services at once,
+// instead of stopping dependent services before their dependencies.
+func (c *Composer) EnableParallelShutdown() {
+	c.parallelShutdown = true
+}
+
 func (c *Composer) prepareServices() error {
 	for i := range c.services {
 		service := c.services[i]
@@ -116,6 +241,10 @@ func (c *Composer) prepareServices() error {
 		if err := c.prepareService(service); err != nil {
 			return fmt.Errorf("cannot initialize service %s: %w", service.name, err)
 		}
+
+		if !service.isDependency {
+			c.topLevelWait.Add(1)
+		}
 	}
 
 	return nil
@@ -138,6 +267,32 @@ func (c *Composer) prepareService(service *Service) error {
 	return nil
 }
 
+func (c *Composer) openLogFiles() error {
+	for _, service := range c.services {
+		if service.logFile == nil {
+			continue
+		}
+
+		if err := service.logFile.open(); err != nil {
+			return fmt.Errorf("error preparing service %s: %w", service.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Composer) closeLogFiles() {
+	for _, service := range c.services {
+		if service.logFile == nil {
+			continue
+		}
+
+		if err := service.logFile.Close(); err != nil {
+			c.info("Cannot close log file of service %s: %v", service.name, err)
+		}
+	}
+}
+
 const terminalResetColor = "\033[0m"
 
 var terminalColors = []string{
@@ -149,9 +304,9 @@ var terminalColors = []string{
 	"\033[36m", // cyan
 }
 
-func (c *Composer) registerOutputs(service *Service) error {
-	color := terminalColors[service.id%len(terminalColors)]
-	longestServiceName := len(service.name)
+// setLogPrefixes sets colored prefixes of output lines of all services (aligned to the longest service name)
+func (c *Composer) setLogPrefixes() {
+	longestServiceName := 0
 
 	for i := range c.services {
 		if longestServiceName < len(c.services[i].name) {
@@ -159,99 +314,136 @@ func (c *Composer) registerOutputs(service *Service) error {
 		}
 	}
 
-	prefixSpace := strings.Repeat(" ", longestServiceName-len(service.name))
+	for _, service := range c.services {
+		color := terminalColors[service.id%len(terminalColors)]
+		prefixSpace := strings.Repeat(" ", longestServiceName-len(service.name))
 
-	service.logPrefix = fmt.Sprintf("\r%s["+service.name+"]%s |%s", color, prefixSpace, terminalResetColor)
+		service.logPrefix = fmt.Sprintf("\r%s["+service.name+"]%s |%s", color, prefixSpace, terminalResetColor)
+	}
+}
 
-	if err := c.registerOutput(service, service.cmd.StdoutPipe, os.Stdout); err != nil {
+func (c *Composer) registerOutputs(service *Service) error {
+	if err := c.registerOutput(service, service.cmd.StdoutPipe, StreamStdout); err != nil {
 		return fmt.Errorf("cannot register stdout: %w", err)
 	}
 
-	if err := c.registerOutput(service, service.cmd.StderrPipe, os.Stderr); err != nil {
+	if err := c.registerOutput(service, service.cmd.StderrPipe, StreamStderr); err != nil {
 		return fmt.Errorf("cannot register stderr: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Composer) registerOutput(service *Service, readerFn func() (io.ReadCloser, error), writer io.Writer) error {
+func (c *Composer) registerOutput(service *Service, readerFn func() (io.ReadCloser, error), stream string) error {
 	reader, err := readerFn()
 	if err != nil {
 		return fmt.Errorf("cannot get reader: %w", err)
 	}
 
-	if !service.isDependency {
-		c.outputWait.Add(1)
-	}
+	service.outputWait.Add(1)
 
 	bufReader := bufio.NewReader(reader)
 
-	go func() {
-		if !service.isDependency {
-			defer c.outputWait.Done()
-		}
+	// the collapse mode is validated by NewService
+	repeats, _ := newRepeatFilter(service.collapseRepeats)
 
-		lastLine := ""
+	go func() {
+		defer service.outputWait.Done()
 
 		for line := ""; err == nil; {
 			line, err = bufReader.ReadString('\n')
+			readAt := time.Now()
 			line = strings.TrimRight(line, "\r\n")
 
-			// skip repeated lines
-			if strings.EqualFold(line, lastLine) {
+			// the final read at EOF is empty when output ends with a new line
+			if err != nil && line == "" {
 				continue
 			}
 
-			lastLine = line
+			// log files get complete output
+			if service.logFile != nil {
+				_, _ = fmt.Fprintln(service.logFile, line)
+			}
 
-			_, _ = fmt.Fprintln(writer, service.logPrefix, line)
+			show, repeated := repeats.next(line)
+			if repeated > 0 {
+				c.printRepeats(service, stream, repeated, readAt)
+			}
 
-			if service.readyOn != "" && strings.Contains(line, service.readyOn) {
-				service.readyOnce.Do(func() {
-					service.ready <- true
-				})
+			if !show {
+				continue
 			}
+
+			c.printLine(service, stream, line, readAt)
+
+			service.output.add(line)
+
+			service.matchReadyOn(line)
+		}
+
+		if repeated := repeats.flush(); repeated > 0 {
+			c.printRepeats(service, stream, repeated, time.Now())
 		}
 
 		if err != io.EOF {
-			_, _ = fmt.Fprintln(os.Stderr, service.name, fmt.Sprintf("reader error: %v", err))
+			c.error("%s reader error: %v", service.name, err)
 		}
 	}()
 
 	return nil
 }
 
-func (c *Composer) startServices() error {
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGHUP)
+// startServices starts services as soon as all of their dependencies are ready
+// (independent services are started in parallel, up to maxParallel services at a time).
+func (c *Composer) startServices(signalCh <-chan os.Signal) error {
+	type readyResult struct {
+		service *Service
+		err     error
+	}
 
-	for i := range c.services {
-		service := c.services[i]
+	results := make(chan readyResult, len(c.services))
+	started := make(map[string]bool, len(c.services))
+	ready := make(map[string]bool, len(c.services))
+	starting := 0
 
-		c.info("Starting service %s", service.name)
-		if err := service.cmd.Start(); err != nil {
-			return fmt.Errorf("error starting service %s: %w", service.name, err)
-		}
+	for len(ready) < len(c.services) {
+		for i := range c.services {
+			service := c.services[i]
 
-		go func() {
-			c.debug("waiting for: %s", service.name)
-			// we must first wait for command stdout / stderr because cmd.Wait() will close pipes after seeing the command exit
-			// see: https://pkg.go.dev/os/exec#Cmd.StdoutPipe
-			c.outputWait.Wait()
-			err := service.cmd.Wait()
-			c.debug("wait-err from %s: %v", service.name, err)
-			c.quit(service.name, err)
-		}()
+			if c.maxParallel > 0 && starting >= c.maxParallel {
+				break
+			}
+
+			if started[service.name] || !dependenciesReady(service, ready) {
+				continue
+			}
+
+			// services are started in the background, so signals and errors are handled in the meantime
+			go func() {
+				results <- readyResult{service: service, err: c.launchService(service)}
+			}()
+
+			started[service.name] = true
+			starting++
+		}
 
-		c.info("Waiting for service %s to be ready", service.name)
 		select {
-		case <-service.ready:
-			c.debug("%s is ready", service.name)
-		case <-signalCh:
-			c.Interrupt()
-		case err := <-service.error:
-			c.debug("service %s error: %v", service.name, err)
-			return err
+		case result := <-results:
+			if result.err != nil {
+				c.debug("service %s error: %v", result.service.name, result.err)
+				return result.err
+			}
+
+			c.readyEvent(result.service)
+			ready[result.service.name] = true
+			starting--
+
+			if result.service.liveness != nil {
+				service := result.service
+				c.goCheck(func() { c.runLivenessCheck(service) })
+			}
+		case sig := <-signalCh:
+			c.handleSignal(sig)
 		case err := <-c.lastError:
 			c.debug("global (service) error: %v", err)
 			return err
@@ -262,8 +454,8 @@ func (c *Composer) startServices() error {
 
 	for {
 		select {
-		case <-signalCh:
-			c.Interrupt()
+		case sig := <-signalCh:
+			c.handleSignal(sig)
 		case err := <-c.lastError:
 			c.debug("global error: %v", err)
 			return err
@@ -271,16 +463,633 @@ func (c *Composer) startServices() error {
 	}
 }
 
-func (c *Composer) info(msg string, args ...interface{}) {
-	fmt.Println("[composer]", fmt.Sprintf(msg, args...))
+func dependenciesReady(service *Service, ready map[string]bool) bool {
+	for _, dependency := range service.dependsOn {
+		if !ready[dependency] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// launchService starts the service with its supervisor and waits until it's ready
+func (c *Composer) launchService(service *Service) error {
+	c.event(service, EventStarting, "Starting service %s", service.name)
+
+	started, err := c.startService(service)
+	if err != nil {
+		return fmt.Errorf("error starting service %s: %w", service.name, err)
+	}
+
+	if !started {
+		return fmt.Errorf("composer stopped before service %s was started", service.name)
+	}
+
+	go c.superviseService(service)
+
+	if service.readyCheck != nil {
+		c.goCheck(func() {
+			if err := c.runReadyCheck(service); err != nil {
+				service.error <- err
+			}
+		})
+	}
+
+	return c.waitForReady(service)
+}
+
+// startService runs pre_start and post_start hooks around starting the service's command.
+// The service is not started (and false is returned) when composer is stopping.
+func (c *Composer) startService(service *Service) (bool, error) {
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	c.importExports(service)
+
+	if err := c.runServiceHook(ctx, service, "pre_start", service.hooks.preStart, 0); err != nil {
+		return false, err
+	}
+
+	// the service isn't started once composer is stopping (checked with the lock held, see stopService)
+	service.lock.Lock()
+	if c.isStopping() {
+		service.lock.Unlock()
+		return false, nil
+	}
+	err := service.start()
+	service.lock.Unlock()
+
+	if err != nil {
+		return false, err
+	}
+
+	if err = c.runServiceHook(ctx, service, "post_start", service.hooks.postStart, 0); err != nil {
+		c.serviceInfo(service, "%v", err)
+	}
+
+	return true, nil
+}
+
+// superviseService waits for the service to exit and restarts it according to its restart policy.
+// Once the service won't be restarted anymore, its exit is reported to composer.
+func (c *Composer) superviseService(service *Service) {
+	var err error
+	// gaveUp is set when the service failed and its restart policy doesn't allow restarting it anymore
+	var gaveUp bool
+
+	for {
+		service.lock.Lock()
+		exited := service.exited
+		service.lock.Unlock()
+
+		c.debug("waiting for: %s", service.name)
+		err = service.wait()
+		c.debug("wait-err from %s: %v", service.name, err)
+
+		// the service was stopped because it didn't pass its ready check after a restart
+		readyErr := service.takeReadyError()
+		if readyErr != nil {
+			err = readyErr
+		}
+
+		service.recordExit(err, c.isStopping() || service.exitRequested())
+		c.exitEvent(service, err)
+		c.runExitHooks(service, err)
+		close(exited)
+
+		if readyErr == nil {
+			err = newServiceExitError(service, err)
+		}
+
+		if c.isStopping() {
+			break
+		}
+
+		var delay time.Duration
+
+		if service.takeStopRequest() {
+			c.event(service, EventStopped, "Service %s stopped", service.name)
+
+			if !c.waitForStartRequest(service) {
+				break
+			}
+
+			c.event(service, EventStarting, "Starting service %s", service.name)
+		} else {
+			var restart bool
+			var crashErr error
+
+			delay, restart, crashErr = service.nextRestart(err)
+			if crashErr != nil {
+				err = crashErr
+				gaveUp = true
+				break
+			}
+
+			if !restart {
+				gaveUp = service.restartsExhausted(err)
+				if gaveUp || !c.waitForRestartRequest(service) {
+					break
+				}
+			}
+
+			c.event(service, EventRestarting, "Restarting service %s in %v", service.name, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-c.stopping:
+		}
+
+		restarted, restartErr := c.restartService(service)
+		if restartErr != nil {
+			err = fmt.Errorf("error restarting service %s: %w", service.name, restartErr)
+			break
+		}
+
+		if !restarted {
+			break
+		}
+	}
+
+	if service.isTask {
+		if err != nil {
+			service.error <- err
+		} else {
+			c.debug("task %s completed successfully", service.name)
+			service.markReady(nil)
+		}
+	}
+
+	service.finish(err)
+
+	// a completed dependency is not a reason to stop other services
+	if service.isTask && service.isDependency && err == nil {
+		return
+	}
+
+	if !service.isDependency {
+		c.topLevelWait.Done()
+	}
+
+	// a service which crash loops or runs out of restarts stops composer right away (even when it's a dependency),
+	// otherwise services which are not explicitly requested may exit only after all requested services are done
+	if !gaveUp {
+		c.topLevelWait.Wait()
+	}
+
+	c.quit(service.name, err)
 }
 
-func (c *Composer) debug(msg string, args ...interface{}) {
-	if !c.debugEnabled {
+// runExitHooks runs hooks of the service which exited with err
+func (c *Composer) runExitHooks(service *Service, err error) {
+	if hookErr := c.runServiceHook(context.Background(), service, "post_stop", service.hooks.postStop, service.killTimeout); hookErr != nil {
+		c.serviceInfo(service, "%v", hookErr)
+	}
+
+	if err == nil || c.isStopping() || service.exitRequested() {
 		return
 	}
 
-	fmt.Println("[composer-debug]", fmt.Sprintf(msg, args...))
+	if hookErr := c.runServiceHook(context.Background(), service, "on_failure", service.hooks.onFailure, service.killTimeout); hookErr != nil {
+		c.serviceInfo(service, "%v", hookErr)
+	}
+}
+
+// restartService prepares and starts a new instance of the service's command.
+// The service is not restarted (and false is returned) when composer is stopping.
+func (c *Composer) restartService(service *Service) (bool, error) {
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	c.importExports(service)
+
+	if err := c.runServiceHook(ctx, service, "pre_start", service.hooks.preStart, 0); err != nil {
+		return false, err
+	}
+
+	service.lock.Lock()
+	rearmed := service.resetReady()
+	service.lock.Unlock()
+
+	restarted, err := c.restartCmd(service)
+	if !restarted || err != nil {
+		return restarted, err
+	}
+
+	// the new instance must pass the ready check again
+	if rearmed && service.readyCheck != nil {
+		c.goCheck(func() { c.recheckReady(service) })
+	}
+
+	if err = c.runServiceHook(ctx, service, "post_start", service.hooks.postStart, 0); err != nil {
+		c.serviceInfo(service, "%v", err)
+	}
+
+	return true, nil
+}
+
+func (c *Composer) restartCmd(service *Service) (bool, error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	if c.isStopping() {
+		return false, nil
+	}
+
+	if err := c.prepareService(service); err != nil {
+		return false, err
+	}
+
+	if err := service.start(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Status returns statuses of all services (in order in which they are started)
+func (c *Composer) Status() []ServiceStatus {
+	result := make([]ServiceStatus, len(c.services))
+
+	for i, service := range c.services {
+		result[i] = service.status()
+	}
+
+	return result
+}
+
+func (c *Composer) findService(name string) (*Service, error) {
+	for _, service := range c.services {
+		if service.name == name {
+			return service, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown service: %s", name)
+}
+
+// requestStop stops the service without stopping composer (the service can be started again with requestStart)
+func (c *Composer) requestStop(name string) error {
+	service, err := c.findService(name)
+	if err != nil {
+		return err
+	}
+
+	service.lock.Lock()
+	status := ServiceStatus{State: service.state}
+	if status.IsRunning() {
+		service.stopRequested = true
+	}
+	service.lock.Unlock()
+
+	if !status.IsRunning() {
+		return fmt.Errorf("service %s is not running (%s)", name, status.State)
+	}
+
+	c.stopService(service)
+
+	return nil
+}
+
+// requestStart starts the service stopped by requestStop
+func (c *Composer) requestStart(name string) error {
+	service, err := c.findService(name)
+	if err != nil {
+		return err
+	}
+
+	service.lock.Lock()
+	state := service.state
+	service.lock.Unlock()
+
+	if state != StateStopped {
+		return fmt.Errorf("service %s is not stopped (%s)", name, state)
+	}
+
+	select {
+	case service.startRequests <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// requestRestart restarts a running service, starts a stopped one or a dependency which exited
+func (c *Composer) requestRestart(name string) error {
+	service, err := c.findService(name)
+	if err != nil {
+		return err
+	}
+
+	service.lock.Lock()
+	status := ServiceStatus{State: service.state}
+	awaitsRestart := service.awaitsRestart
+	service.lock.Unlock()
+
+	switch {
+	case status.IsRunning():
+		c.forceRestart(service)
+		return nil
+	case status.State == StateStopped:
+		return c.requestStart(name)
+	case awaitsRestart:
+		select {
+		case service.startRequests <- struct{}{}:
+		default:
+		}
+		return nil
+	default:
+		return fmt.Errorf("service %s cannot be restarted (%s)", name, status.State)
+	}
+}
+
+// Restart restarts the service (or starts it when it was stopped or when it's a dependency which exited)
+// and waits until it's ready again. Other services keep running.
+func (c *Composer) Restart(name string) error {
+	return c.restart(name, false)
+}
+
+// RestartWithDependents restarts the service together with all services which (directly or indirectly) depend on it.
+// Dependent services are stopped first and started again once the service is ready.
+func (c *Composer) RestartWithDependents(name string) error {
+	return c.restart(name, true)
+}
+
+func (c *Composer) restart(name string, withDependents bool) error {
+	service, err := c.findService(name)
+	if err != nil {
+		return err
+	}
+
+	var dependents []*Service
+	if withDependents {
+		dependents = c.runningDependents(service)
+	}
+
+	// dependents are stopped in reverse order, so they are stopped before services they depend on
+	for i := len(dependents) - 1; i >= 0; i-- {
+		if err = c.stopAndWait(dependents[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range append([]*Service{service}, dependents...) {
+		since := time.Now()
+
+		if err = c.requestRestart(s.name); err != nil {
+			return err
+		}
+
+		c.info("Waiting for service %s to be ready again", s.name)
+
+		err = c.waitForService(s, s.readyTimeout, func(status ServiceStatus) bool {
+			return status.State == StateReady && !status.StartedAt.Before(since)
+		})
+		if err != nil {
+			return err
+		}
+
+		c.readyEvent(s)
+	}
+
+	return nil
+}
+
+// runningDependents returns running services which (directly or indirectly) depend on the service (in start order)
+func (c *Composer) runningDependents(service *Service) []*Service {
+	found := map[string]bool{service.name: true}
+
+	var result []*Service
+	for _, s := range c.services {
+		for _, dependency := range s.dependsOn {
+			if found[dependency] && !found[s.name] && s.status().IsRunning() {
+				found[s.name] = true
+				result = append(result, s)
+			}
+		}
+	}
+
+	return result
+}
+
+// stopAndWait stops the running service (as requestStop) and waits until it's marked as stopped
+func (c *Composer) stopAndWait(service *Service) error {
+	if err := c.requestStop(service.name); err != nil {
+		return err
+	}
+
+	return c.waitForService(service, 0, func(status ServiceStatus) bool {
+		return status.State == StateStopped
+	})
+}
+
+// waitForService waits until the status of the service satisfies cond (0 timeout means no limit).
+// It fails when the service won't run anymore, composer is stopping or the timeout elapses.
+func (c *Composer) waitForService(service *Service, timeout time.Duration, cond func(ServiceStatus) bool) error {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	for {
+		service.lock.Lock()
+		changed := service.changed
+		service.lock.Unlock()
+
+		if cond(service.status()) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-service.done:
+			return fmt.Errorf("service %s exited", service.name)
+		case err := <-service.error:
+			return err
+		case <-timeoutCh:
+			return c.readyTimeoutError(service)
+		case <-c.stopping:
+			return fmt.Errorf("composer stopped while waiting for service %s", service.name)
+		}
+	}
+}
+
+// waitForStartRequest waits until the stopped service is requested to start again.
+// It returns false when composer stops first.
+func (c *Composer) waitForStartRequest(service *Service) bool {
+	select {
+	case <-service.startRequests:
+	case <-c.stopping:
+		return false
+	}
+
+	return true
+}
+
+// waitForRestartRequest lets a dependency, which exited after it was ready and isn't restarted by its restart policy,
+// be restarted on request (see requestRestart) while requested services keep running.
+// It returns false when the service can't be restarted this way, or requested services are done or composer stops first.
+func (c *Composer) waitForRestartRequest(service *Service) bool {
+	service.lock.Lock()
+	service.awaitsRestart = service.isDependency && !service.isTask && service.readySignaled
+	awaitsRestart := service.awaitsRestart
+	service.lock.Unlock()
+
+	if !awaitsRestart {
+		return false
+	}
+
+	topLevelDone := make(chan struct{})
+	go func() {
+		c.topLevelWait.Wait()
+		close(topLevelDone)
+	}()
+
+	restart := false
+	select {
+	case <-service.startRequests:
+		restart = true
+	case <-topLevelDone:
+	case <-c.stopping:
+	}
+
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	service.awaitsRestart = false
+	if restart {
+		service.restarts++
+		service.setState(StateRestarting)
+	}
+
+	return restart
+}
+
+// forceRestart stops the running service and makes sure it's restarted regardless of its restart policy
+func (c *Composer) forceRestart(service *Service) {
+	service.lock.Lock()
+	running := ServiceStatus{State: service.state}.IsRunning()
+	if running {
+		service.restartRequested = true
+	}
+	service.lock.Unlock()
+
+	if running {
+		c.stopService(service)
+	}
+}
+
+func describeExit(err error) string {
+	if err == nil {
+		return "exited successfully"
+	}
+
+	return fmt.Sprintf("exited with: %v", err)
+}
+
+// stoppingContext returns a context which is cancelled once composer starts stopping
+func (c *Composer) stoppingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-c.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+func (c *Composer) isStopping() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForReady waits until the service is ready (or a task completes)
+func (c *Composer) waitForReady(service *Service) error {
+	var readyTimeout <-chan time.Time
+	if service.readyTimeout > 0 {
+		readyTimer := time.NewTimer(service.readyTimeout)
+		defer readyTimer.Stop()
+		readyTimeout = readyTimer.C
+	}
+
+	if service.isTask {
+		c.info("Waiting for task %s to complete", service.name)
+	} else {
+		c.info("Waiting for service %s to be ready", service.name)
+	}
+
+	select {
+	case <-service.readyChan():
+		return c.runOnReadyHook(service)
+	case <-readyTimeout:
+		return c.readyTimeoutError(service)
+	case err := <-service.error:
+		return err
+	case <-service.done:
+		// a completed task is marked as ready before it's done
+		select {
+		case <-service.readyChan():
+			return c.runOnReadyHook(service)
+		default:
+		}
+
+		if err := service.finalError(); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("service %s exited before it was ready", service.name)
+	case <-c.stopping:
+		return fmt.Errorf("composer stopped before service %s was ready", service.name)
+	}
+}
+
+// runOnReadyHook runs on_ready hook of the service (it's interrupted when composer stops)
+func (c *Composer) runOnReadyHook(service *Service) error {
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	return c.runServiceHook(ctx, service, "on_ready", service.hooks.onReady, 0)
+}
+
+const readyTimeoutOutputLines = 10
+
+func (c *Composer) readyTimeoutError(service *Service) error {
+	return &ReadinessTimeoutError{
+		Service: service.name,
+		Timeout: service.readyTimeout,
+		Output:  service.output.last(readyTimeoutOutputLines),
+	}
+}
+
+// importExports makes values exported by service's dependencies available in its environment
+func (c *Composer) importExports(service *Service) {
+	imports := make(Environment)
+
+	for _, dependency := range c.services {
+		for _, name := range service.dependsOn {
+			if dependency.name == name {
+				dependency.lock.Lock()
+				imports = dependency.exports.Extends(imports)
+				dependency.lock.Unlock()
+			}
+		}
+	}
+
+	service.lock.Lock()
+	service.imports = imports
+	service.lock.Unlock()
 }
 
 func (c *Composer) quit(serviceName string, err error) {
@@ -304,14 +1113,53 @@ func (c *Composer) quit(serviceName string, err error) {
 
 func (c *Composer) cleanup() {
 	c.debug("cleanup")
+	c.globalEvent(EventShutdownStarted, "Stopping services")
+
+	c.checksLock.Lock()
+	close(c.stopping)
+	c.checksLock.Unlock()
+
+	stopped := make(map[string]chan struct{}, len(c.services))
+	for _, service := range c.services {
+		stopped[service.name] = make(chan struct{})
+	}
 
 	c.cleanupWait.Add(len(c.services))
 
 	for i := range c.services {
-		go c.cleanupService(c.services[i])
+		service := c.services[i]
+
+		go func() {
+			defer close(stopped[service.name])
+
+			// stop dependent services first, so they don't observe their dependencies disappearing
+			if !c.parallelShutdown {
+				for _, dependent := range c.dependents(service) {
+					<-stopped[dependent.name]
+				}
+			}
+
+			c.cleanupService(service)
+		}()
 	}
 
 	c.cleanupWait.Wait()
+	c.checksWait.Wait()
+}
+
+// dependents returns services which directly depend on the service
+func (c *Composer) dependents(service *Service) []*Service {
+	var result []*Service
+
+	for _, other := range c.services {
+		for _, dependency := range other.dependsOn {
+			if dependency == service.name {
+				result = append(result, other)
+			}
+		}
+	}
+
+	return result
 }
 
 func (c *Composer) cleanupService(service *Service) {
@@ -319,37 +1167,55 @@ func (c *Composer) cleanupService(service *Service) {
 
 	c.debug("cleanup %s", service.name)
 
-	if service.cmd == nil {
-		c.debug("cleanup %s - cmd nil", service.name)
+	c.stopService(service)
+}
+
+// stopService interrupts the service's process group and waits for it to exit.
+// When the service doesn't exit within its kill timeout, it's killed.
+func (c *Composer) stopService(service *Service) {
+	service.lock.Lock()
+	cmd, exited := service.cmd, service.exited
+	service.lock.Unlock()
+
+	if cmd == nil {
+		c.debug("stop %s - cmd nil", service.name)
 		return
 	}
 
-	if service.cmd.ProcessState != nil && service.cmd.ProcessState.Exited() {
-		c.debug("cleanup %s - already exited", service.name)
+	if cmd.Process == nil {
+		c.debug("stop %s - no process info", service.name)
 		return
 	}
 
-	if service.cmd.Process == nil {
-		c.debug("cleanup %s - no process info", service.name)
+	select {
+	case <-exited:
+		c.debug("stop %s - already exited", service.name)
 		return
+	default:
 	}
 
-	pid := service.cmd.Process.Pid
+	pid := cmd.Process.Pid
+
+	if err := c.runServiceHook(context.Background(), service, "pre_stop", service.hooks.preStop, service.killTimeout); err != nil {
+		c.serviceInfo(service, "%v", err)
+	}
 
 	killTimer := time.AfterFunc(service.killTimeout, func() {
-		c.debug("cleanup %s - killing %d", service.name, pid)
+		c.debug("stop %s - killing %d", service.name, pid)
 		if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "error killing service %s with PID %d\n", service.name, pid)
+			c.error("error killing service %s with PID %d", service.name, pid)
 		}
 	})
 	defer killTimer.Stop()
 
-	c.debug("cleanup %s - interrupting %d", service.name, pid)
-	if err := syscall.Kill(-pid, syscall.SIGINT); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "error interrupting service %s with PID %d\n", service.name, pid)
+	c.debug("stop %s - sending %v to %d", service.name, service.stopSignal, pid)
+	if err := syscall.Kill(-pid, service.stopSignal); err != nil {
+		c.error("error interrupting service %s with PID %d", service.name, pid)
 	}
 
-	if _, err := service.cmd.Process.Wait(); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "error waiting for service %s with PID %d to die\n", service.name, pid)
+	select {
+	case <-exited:
+	case <-time.After(2 * service.killTimeout):
+		c.error("error waiting for service %s with PID %d to die", service.name, pid)
 	}
 }
@@ -2,10 +2,21 @@ package composer_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -43,7 +54,7 @@ func TestKill(t *testing.T) {
 		},
 	}
 
-	c, err := composer.New(cfg, "test")
+	c, err := composer.New(cfg, []string{"test"})
 	if err != nil {
 		t.Errorf("error: %v", err)
 	}
@@ -75,7 +86,7 @@ func TestRunAll(t *testing.T) {
 		},
 	}
 
-	c, err := composer.New(cfg, "s1", "s2")
+	c, err := composer.New(cfg, []string{"s1", "s2"})
 	if err != nil {
 		t.Errorf("error: %v", err)
 	}
@@ -106,7 +117,7 @@ func TestRunAll_DependencyExistsFirst(t *testing.T) {
 		},
 	}
 
-	c, err := composer.New(cfg, "s1", "s2")
+	c, err := composer.New(cfg, []string{"s1", "s2"})
 	if err != nil {
 		t.Errorf("error: %v", err)
 	}
@@ -140,7 +151,7 @@ func TestLargeOutput(t *testing.T) {
 		Services: map[string]composer.ServiceConfig{"s1": {Command: cmd}},
 	}
 
-	c, err := composer.New(cfg, "s1")
+	c, err := composer.New(cfg, []string{"s1"})
 	if err != nil {
 		t.Errorf("error: %v", err)
 	}
@@ -187,7 +198,7 @@ func TestDaemonDependencies(t *testing.T) {
 		},
 	}
 
-	c, err := composer.New(cfg, "s1")
+	c, err := composer.New(cfg, []string{"s1"})
 	if err != nil {
 		t.Errorf("error: %v", err)
 	}
@@ -209,3 +220,1624 @@ func TestDaemonDependencies(t *testing.T) {
 		t.Errorf("unexpected output value found in actual execution output:\nunexpected: '%s'\ngot '%s'", unexpectedOutput, output)
 	}
 }
+
+func TestReadyCheck_HTTP(t *testing.T) {
+	const readyAfter = 300 * time.Millisecond
+
+	start := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Since(start) < readyAfter {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo 'started'", DependsOn: []string{"d1"}},
+			"d1": {
+				Command: "sleep 5",
+				// the url is expanded with the service's environment
+				Environment: composer.Environment{"ADDR": strings.TrimPrefix(server.URL, "http://")},
+				ReadyCheck: &composer.ReadyCheck{
+					Check:    composer.Check{HTTP: &composer.HTTPCheck{URL: "http://${ADDR}/health"}},
+					Interval: 50 * time.Millisecond,
+				},
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	// c.EnableDebug()
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	if time.Since(start) < readyAfter {
+		t.Errorf("service should be started after %v, it took %v instead", readyAfter, time.Since(start))
+	}
+
+	if !strings.Contains(output, "started") {
+		t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", "started", output)
+	}
+}
+
+func TestReadyCheck_Dial(t *testing.T) {
+	const readyAfter = 300 * time.Millisecond
+
+	tcpAddress := "127.0.0.1:0"
+	unixAddress := filepath.Join(t.TempDir(), "ready.sock")
+
+	tests := []struct {
+		name       string
+		network    string
+		address    *string
+		readyCheck func(address string) *composer.ReadyCheck
+	}{
+		{
+			name:    "tcp",
+			network: "tcp",
+			address: &tcpAddress,
+			readyCheck: func(address string) *composer.ReadyCheck {
+				return &composer.ReadyCheck{Check: composer.Check{TCP: address}}
+			},
+		},
+		{
+			name:    "unix",
+			network: "unix",
+			address: &unixAddress,
+			readyCheck: func(address string) *composer.ReadyCheck {
+				return &composer.ReadyCheck{Check: composer.Check{Unix: address}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// reserve an address, but don't accept connections until readyAfter elapses
+			listener, err := net.Listen(tt.network, *tt.address)
+			if err != nil {
+				t.Fatalf("cannot listen: %v", err)
+			}
+			address := listener.Addr().String()
+			_ = listener.Close()
+
+			start := time.Now()
+			listening := make(chan net.Listener, 1)
+			time.AfterFunc(readyAfter, func() {
+				listener, err := net.Listen(tt.network, address)
+				if err != nil {
+					t.Errorf("cannot listen: %v", err)
+				}
+				listening <- listener
+			})
+			defer func() {
+				if listener := <-listening; listener != nil {
+					_ = listener.Close()
+				}
+			}()
+
+			readyCheck := tt.readyCheck(address)
+			readyCheck.Interval = 50 * time.Millisecond
+
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "echo 'started'", DependsOn: []string{"d1"}},
+					"d1": {Command: "sleep 5", ReadyCheck: readyCheck},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if time.Since(start) < readyAfter {
+				t.Errorf("service should be started after %v, it took %v instead", readyAfter, time.Since(start))
+			}
+
+			if !strings.Contains(output, "started") {
+				t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", "started", output)
+			}
+		})
+	}
+}
+
+func TestReadyCheck_Command(t *testing.T) {
+	workdir := t.TempDir()
+
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo 'started'", DependsOn: []string{"d1"}},
+			"d1": {
+				// the check relies on the service's workdir and environment
+				Command:     "sleep 0.3 && touch \"$MARKER\" && sleep 5",
+				Workdir:     workdir,
+				Environment: composer.Environment{"MARKER": "ready.marker"},
+				ReadyCheck: &composer.ReadyCheck{
+					Check:    composer.Check{Command: "test -f \"$MARKER\""},
+					Interval: 50 * time.Millisecond,
+				},
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	if !strings.Contains(output, "started") {
+		t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", "started", output)
+	}
+}
+
+func TestReadyCheck_Attempts(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo 'started'", DependsOn: []string{"d1"}},
+			"d1": {
+				Command: "sleep 5",
+				ReadyCheck: &composer.ReadyCheck{
+					Check:    composer.Check{Command: "exit 1"},
+					Interval: 10 * time.Millisecond,
+					Attempts: 3,
+				},
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err == nil || !strings.Contains(err.Error(), "not ready after 3 check attempts") {
+		t.Errorf("expected ready check error, got: %v", err)
+	}
+
+	if strings.Contains(output, "started") {
+		t.Errorf("unexpected output value found in actual execution output:\nunexpected: '%s'\ngot '%s'", "started", output)
+	}
+}
+
+func TestReadyOnRegex_Exports(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {
+				Command:     "echo \"port=$SERVICE_DB_PORT url=$URL\"",
+				Environment: composer.Environment{"URL": "http://localhost:${SERVICE_DB_PORT}"},
+				DependsOn:   []string{"db"},
+			},
+			"db": {
+				Command:      "echo 'listening on port 4242' && sleep 5",
+				ReadyOnRegex: `port (?P<port>\d+)`,
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	const expectedOutput = "port=4242 url=http://localhost:4242"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", expectedOutput, output)
+	}
+}
+
+func TestInheritedEnvironment(t *testing.T) {
+	original, isSet := os.LookupEnv("COMPOSER_TEST_VAR")
+	_ = os.Setenv("COMPOSER_TEST_VAR", "inherited")
+	t.Cleanup(func() {
+		if isSet {
+			_ = os.Setenv("COMPOSER_TEST_VAR", original)
+		} else {
+			_ = os.Unsetenv("COMPOSER_TEST_VAR")
+		}
+	})
+
+	// services without any environment inherit composer's own environment (along with exports of dependencies)
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo \"var=$COMPOSER_TEST_VAR port=$SERVICE_DB_PORT\"", DependsOn: []string{"db"}},
+			"db": {Command: "echo 'listening on port 4242' && sleep 5", ReadyOnRegex: `port (?P<port>\d+)`},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	const expectedOutput = "var=inherited port=4242"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", expectedOutput, output)
+	}
+}
+
+func TestExportName(t *testing.T) {
+	tests := []struct {
+		service string
+		group   string
+		want    string
+	}{
+		{service: "db", group: "port", want: "SERVICE_DB_PORT"},
+		{service: "api-gateway", group: "Token", want: "SERVICE_API_GATEWAY_TOKEN"},
+		{service: "cache.v2", group: "port_1", want: "SERVICE_CACHE_V2_PORT_1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := composer.ExportName(tt.service, tt.group); got != tt.want {
+				t.Errorf("ExportName() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyTimeout(t *testing.T) {
+	cfg := composer.Config{
+		Version:      composer.Version,
+		ReadyTimeout: time.Second,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo 'started'", DependsOn: []string{"d1"}},
+			"d1": {Command: "echo 'starting up' && sleep 5", ReadyOn: "never printed"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	start := time.Now()
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err == nil || !strings.Contains(err.Error(), "service d1 not ready after 1s") {
+		t.Errorf("expected ready timeout error, got: %v", err)
+	}
+
+	if err != nil && !strings.Contains(err.Error(), "starting up") {
+		t.Errorf("expected ready timeout error to contain last output, got: %v", err)
+	}
+
+	if strings.Contains(output, "started") {
+		t.Errorf("unexpected output value found in actual execution output:\nunexpected: '%s'\ngot '%s'", "started", output)
+	}
+
+	const doneBefore = 3 * time.Second
+	if time.Since(start) > doneBefore {
+		t.Errorf("composer should fail before %v, it took %v instead", doneBefore, time.Since(start))
+	}
+}
+
+func TestRestart(t *testing.T) {
+	// the command fails on the first two runs and succeeds on the third one
+	const flakyCommand = "n=$(cat runs 2>/dev/null || echo 0); echo $((n+1)) > runs; echo \"run $n\"; [ $n -ge 2 ]"
+
+	tests := []struct {
+		name    string
+		service composer.ServiceConfig
+		// dependency makes s1 a dependency of a long-running service
+		dependency bool
+		wantErr    string
+		wantRuns   int
+	}{
+		{
+			name: "on-failure",
+			service: composer.ServiceConfig{
+				Command:        flakyCommand,
+				Restart:        composer.RestartOnFailure,
+				RestartBackoff: 10 * time.Millisecond,
+			},
+			wantRuns: 3,
+		},
+		{
+			name: "max restarts",
+			service: composer.ServiceConfig{
+				Command:        flakyCommand,
+				Restart:        composer.RestartAlways,
+				MaxRestarts:    1,
+				RestartBackoff: 10 * time.Millisecond,
+			},
+			wantErr:  "exit status 1",
+			wantRuns: 2,
+		},
+		{
+			name: "crash loop",
+			service: composer.ServiceConfig{
+				Command:        flakyCommand,
+				Restart:        composer.RestartOnFailure,
+				RestartBackoff: 10 * time.Millisecond,
+				CrashLoopLimit: 1,
+			},
+			wantErr:  "crash looping",
+			wantRuns: 2,
+		},
+		{
+			name: "dependency max restarts",
+			service: composer.ServiceConfig{
+				Command:        flakyCommand,
+				Restart:        composer.RestartOnFailure,
+				MaxRestarts:    1,
+				RestartBackoff: 10 * time.Millisecond,
+			},
+			dependency: true,
+			wantErr:    "exit status 1",
+			wantRuns:   2,
+		},
+		{
+			name: "dependency crash loop before ready",
+			service: composer.ServiceConfig{
+				Command:        flakyCommand,
+				ReadyOn:        "never",
+				Restart:        composer.RestartAlways,
+				RestartBackoff: 10 * time.Millisecond,
+				CrashLoopLimit: 1,
+			},
+			dependency: true,
+			wantErr:    "crash looping",
+			wantRuns:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.service.Workdir = t.TempDir()
+
+			cfg := composer.Config{
+				Version:  composer.Version,
+				Services: map[string]composer.ServiceConfig{"s1": tt.service},
+			}
+
+			services := []string{"s1"}
+			if tt.dependency {
+				cfg.Services["main"] = composer.ServiceConfig{Command: "sleep 5", DependsOn: []string{"s1"}}
+				services = []string{"main"}
+			}
+
+			c, err := composer.New(cfg, services)
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			startedAt := time.Now()
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if elapsed := time.Since(startedAt); elapsed > 3*time.Second {
+				t.Errorf("expected composer to stop once s1 failed, it took: %v", elapsed)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error '%s', got: %v", tt.wantErr, err)
+			}
+
+			if want := "run " + strconv.Itoa(tt.wantRuns-1); !strings.Contains(output, want) {
+				t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", want, output)
+			}
+
+			if unwanted := "run " + strconv.Itoa(tt.wantRuns); strings.Contains(output, unwanted) {
+				t.Errorf("unexpected output value found in actual execution output:\nunexpected: '%s'\ngot '%s'", unwanted, output)
+			}
+		})
+	}
+}
+
+func TestRestart_OtherServicesKeepRunning(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 0.5 && echo 'still running'", DependsOn: []string{"w1"}},
+			"w1": {Command: "sleep 0.1 && exit 1", Restart: composer.RestartAlways, RestartBackoff: 10 * time.Millisecond},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	if !strings.Contains(output, "still running") {
+		t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", "still running", output)
+	}
+
+	if !strings.Contains(output, "Service w1 exited with: exit status 1\n[composer] Restarting service w1") {
+		t.Errorf("expected restart message not found in actual execution output:\ngot '%s'", output)
+	}
+}
+
+func TestRestart_ReadyCheckFailure(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"w1": {
+				// the first run is ready and crashes, the restarted one never gets ready
+				Command:        "if [ -f ran ]; then sleep 5; else touch ready && sleep 0.3 && rm ready && touch ran && exit 1; fi",
+				Workdir:        t.TempDir(),
+				Restart:        composer.RestartOnFailure,
+				MaxRestarts:    1,
+				RestartBackoff: 10 * time.Millisecond,
+				ReadyCheck: &composer.ReadyCheck{
+					Check:    composer.Check{Command: "test -f ready"},
+					Interval: 50 * time.Millisecond,
+					Attempts: 3,
+				},
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"w1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	start := time.Now()
+
+	_ = captureStdoutStderr(func() { err = c.Run() })
+	if err == nil || !strings.Contains(err.Error(), "service w1 not ready after 3 check attempts") {
+		t.Errorf("expected ready check error, got: %v", err)
+	}
+
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("composer should stop once the restarted service fails its ready check, it took %v instead", time.Since(start))
+	}
+}
+
+func TestLivenessCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		onFailure composer.LivenessAction
+		wantErr   string
+		wantRuns  int
+	}{
+		{name: "restart", onFailure: composer.LivenessRestart, wantRuns: 2},
+		{name: "abort", onFailure: composer.LivenessAbort, wantErr: "service w1 is unhealthy", wantRuns: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "sleep 1", DependsOn: []string{"w1"}},
+					"w1": {
+						// the service becomes unhealthy after a while, but keeps running
+						Command: "touch alive && echo 'w1 up' && sleep 0.3 && rm alive && sleep 5",
+						Workdir: t.TempDir(),
+						LivenessCheck: &composer.LivenessCheck{
+							Check:            composer.Check{Command: "test -f alive"},
+							Period:           50 * time.Millisecond,
+							FailureThreshold: 2,
+							OnFailure:        tt.onFailure,
+						},
+					},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error '%s', got: %v", tt.wantErr, err)
+			}
+
+			if !strings.Contains(output, "liveness check failed (2/2)") {
+				t.Errorf("expected liveness message not found in actual execution output:\ngot '%s'", output)
+			}
+
+			if runs := strings.Count(output, "w1 up"); runs < tt.wantRuns {
+				t.Errorf("service should run at least %d times, it ran %d times instead:\ngot '%s'", tt.wantRuns, runs, output)
+			}
+		})
+	}
+}
+
+func TestLivenessCheck_NotReady(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"w1": {
+				// the service is healthy only once it's ready
+				Command:      "rm -f alive && sleep 0.5 && touch alive && echo 'w1 up' && sleep 5",
+				ReadyOn:      "w1 up",
+				ReadyTimeout: 2 * time.Second,
+				Workdir:      t.TempDir(),
+				LivenessCheck: &composer.LivenessCheck{
+					Check:            composer.Check{Command: "test -f alive"},
+					Period:           50 * time.Millisecond,
+					FailureThreshold: 2,
+				},
+			},
+		},
+	}
+
+	var stdout bytes.Buffer
+
+	// output is captured by composer, so it can be written while c.Interrupt is called from another goroutine
+	c, err := composer.New(cfg, []string{"w1"}, composer.WithStdout(&stdout))
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	time.AfterFunc(800*time.Millisecond, func() {
+		if err := c.Restart("w1"); err != nil {
+			t.Errorf("error restarting w1: %v", err)
+		}
+		c.Interrupt()
+	})
+
+	err = c.Run()
+	output := stdout.String()
+	if !errors.Is(err, composer.ErrInterrupted) {
+		t.Errorf("expected interrupted error, got: %v", err)
+	}
+
+	if strings.Contains(output, "liveness check failed") {
+		t.Errorf("service should not be checked while it's starting:\ngot '%s'", output)
+	}
+
+	if runs := strings.Count(output, "w1 up"); runs != 2 {
+		t.Errorf("service should run 2 times, it ran %d times instead:\ngot '%s'", runs, output)
+	}
+}
+
+func TestTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		task       string
+		wantErr    string
+		wantOutput string
+	}{
+		{name: "success", task: "sleep 0.2 && echo 'migrated' > state", wantOutput: "state: migrated"},
+		{name: "failure", task: "echo 'migration failed' && exit 3", wantErr: "task m1 failed: exit status 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workdir := t.TempDir()
+
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "echo \"state: $(cat state)\"", Workdir: workdir, DependsOn: []string{"m1", "d1"}},
+					"d1": {Command: "sleep 5"},
+					"m1": {Command: tt.task, Workdir: workdir, Type: composer.ServiceTypeTask},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error '%s', got: %v", tt.wantErr, err)
+			}
+
+			if tt.wantOutput != "" && !strings.Contains(output, tt.wantOutput) {
+				t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", tt.wantOutput, output)
+			}
+
+			if tt.wantErr != "" && strings.Contains(output, "state:") {
+				t.Errorf("dependent service should not be started after the task failed:\ngot '%s'", output)
+			}
+		})
+	}
+}
+
+func TestParallelStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxParallel int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{name: "unlimited", maxParallel: 0, minDuration: 500 * time.Millisecond, maxDuration: 900 * time.Millisecond},
+		{name: "sequential", maxParallel: 1, minDuration: 1500 * time.Millisecond, maxDuration: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "echo 'started'", DependsOn: []string{"d1", "d2", "d3"}},
+					"d1": {Command: "sleep 0.5 && echo 'ready' && sleep 5", ReadyOn: "ready"},
+					"d2": {Command: "sleep 0.5 && echo 'ready' && sleep 5", ReadyOn: "ready"},
+					"d3": {Command: "sleep 0.5 && echo 'ready' && sleep 5", ReadyOn: "ready"},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			c.SetMaxParallel(tt.maxParallel)
+
+			start := time.Now()
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if !strings.Contains(output, "started") {
+				t.Errorf("expected output value not found in actual execution output:\nwant: '%s'\ngot '%s'", "started", output)
+			}
+
+			if took := time.Since(start); took < tt.minDuration || took > tt.maxDuration {
+				t.Errorf("services should be started in %v - %v, it took %v instead", tt.minDuration, tt.maxDuration, took)
+			}
+		})
+	}
+}
+
+func TestShutdownOrder(t *testing.T) {
+	tests := []struct {
+		name             string
+		parallelShutdown bool
+		wantFirst        string
+		wantSecond       string
+	}{
+		{name: "ordered", wantFirst: "api stopped", wantSecond: "db stopped"},
+		{name: "parallel", parallelShutdown: true, wantFirst: "db stopped", wantSecond: "api stopped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "sleep 0.2", DependsOn: []string{"api"}},
+					// the api takes a while to stop, so it would be still running without its database
+					"api": {
+						Command:   "trap 'sleep 0.3; echo api stopped; exit 0' INT; while true; do sleep 0.1; done",
+						DependsOn: []string{"db"},
+					},
+					"db": {Command: "trap 'echo db stopped; exit 0' INT; while true; do sleep 0.1; done"},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			if tt.parallelShutdown {
+				c.EnableParallelShutdown()
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			first, second := strings.Index(output, tt.wantFirst), strings.Index(output, tt.wantSecond)
+			if first < 0 || second < 0 || first > second {
+				t.Errorf("expected '%s' before '%s' in actual execution output:\ngot '%s'", tt.wantFirst, tt.wantSecond, output)
+			}
+		})
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 0.2", DependsOn: []string{"d1"}},
+			"d1": {
+				// the service only handles SIGTERM gracefully
+				Command:     "trap '' INT; trap 'echo terminated gracefully; exit 0' TERM; while true; do sleep 0.1; done",
+				Environment: composer.Environment{"WORKERS": "4"},
+				StopSignal:  "SIGTERM",
+				PreStop:     "echo \"draining $WORKERS workers\"",
+				KillTimeout: 2,
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	draining, terminated := strings.Index(output, "draining 4 workers"), strings.Index(output, "terminated gracefully")
+	if draining < 0 || terminated < 0 || draining > terminated {
+		t.Errorf("expected pre_stop output before graceful termination in actual execution output:\ngot '%s'", output)
+	}
+}
+
+func TestStopSignal_Invalid(t *testing.T) {
+	cfg := composer.Config{
+		Version:  composer.Version,
+		Services: map[string]composer.ServiceConfig{"s1": {Command: "sleep 1", StopSignal: "SIGNOPE"}},
+	}
+
+	if _, err := composer.New(cfg, []string{"s1"}); err == nil || !strings.Contains(err.Error(), "unsupported signal: SIGNOPE") {
+		t.Errorf("expected invalid stop_signal error, got: %v", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "hooks.log")
+
+	cfg := composer.Config{
+		Version:     composer.Version,
+		Environment: composer.Environment{"LOG": log},
+		BeforeAll:   "echo before_all >> \"$LOG\"",
+		AfterAll:    "echo after_all >> \"$LOG\"",
+		Services: map[string]composer.ServiceConfig{
+			"s1": {
+				Command:   "echo s1 >> \"$LOG\" && exit 2",
+				DependsOn: []string{"d1"},
+				OnFailure: "echo s1 on_failure >> \"$LOG\"",
+			},
+			"d1": {
+				Command:   "sleep 5",
+				PreStart:  "echo d1 pre_start >> \"$LOG\"",
+				PostStart: "echo d1 post_start >> \"$LOG\"",
+				OnReady:   "echo d1 on_ready >> \"$LOG\"",
+				PostStop:  "echo d1 post_stop >> \"$LOG\"",
+				// on_failure is not executed for services stopped by composer
+				OnFailure: "echo d1 on_failure >> \"$LOG\"",
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	_ = captureStdoutStderr(func() { err = c.Run() })
+	if err == nil || !strings.Contains(err.Error(), "exit status 2") {
+		t.Errorf("expected s1 error, got: %v", err)
+	}
+
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("cannot read hooks log: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"before_all",
+		"d1 pre_start",
+		"d1 post_start",
+		"d1 on_ready",
+		"s1",
+		"s1 on_failure",
+		"d1 post_stop",
+		"after_all",
+	}, "\n") + "\n"
+
+	if string(got) != want {
+		t.Errorf("unexpected hooks order:\nwant: '%s'\ngot '%s'", want, got)
+	}
+}
+
+func TestHooks_Interrupt(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo started && sleep 5", PreStart: "sleep 4"},
+		},
+	}
+
+	var stdout bytes.Buffer
+
+	c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(&stdout))
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	time.AfterFunc(300*time.Millisecond, c.Interrupt)
+
+	start := time.Now()
+
+	err = c.Run()
+	output := stdout.String()
+	if !errors.Is(err, composer.ErrInterrupted) {
+		t.Errorf("expected interrupted error, got: %v", err)
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("composer should be interrupted while pre_start hook runs, it took %v instead", time.Since(start))
+	}
+
+	if strings.Contains(output, "started") {
+		t.Errorf("service should not be started after composer was interrupted:\ngot '%s'", output)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := composer.Config{
+		Version:     composer.Version,
+		LogDir:      filepath.Join(dir, "logs"),
+		LogMaxSize:  10 * composer.B,
+		LogMaxFiles: 1,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo first && echo second && echo third", DependsOn: []string{"d1"}},
+			// d1 is ready only once all of its lines are written to the log file
+			"d1": {Command: "echo d1 && echo d1 && echo d1 && echo up && sleep 5", ReadyOn: "up", LogFile: filepath.Join(dir, "d1.log")},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	_ = captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"logs/s1.log":   "third\n",
+		"logs/s1.log.1": "second\n",
+		// repeated lines are kept in log files
+		"d1.log.1": "d1\nd1\nd1\n",
+		"d1.log":   "up\n",
+	}
+
+	for name, want := range wantFiles {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("cannot read log file: %v", err)
+		}
+
+		if string(got) != want {
+			t.Errorf("unexpected content of %s:\nwant: '%s'\ngot '%s'", name, want, got)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "logs/s1.log.2")); !os.IsNotExist(err) {
+		t.Errorf("expected only one rotated file to be kept")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    composer.ByteSize
+		wantErr bool
+	}{
+		{value: "100", want: 100},
+		{value: "512KB", want: 512 * composer.KB},
+		{value: "10 mb", want: 10 * composer.MB},
+		{value: "1GB", want: composer.GB},
+		{value: "1TB", wantErr: true},
+		{value: "-1B", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := composer.ParseByteSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseByteSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseByteSize() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo out && echo err >&2 && exit 3", DependsOn: []string{"d1"}},
+			"d1": {Command: "echo 'd1 up' && sleep 5", ReadyOn: "d1 up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	if err = c.SetOutputFormat("xml"); err == nil {
+		t.Errorf("expected unknown output format error")
+	}
+
+	if err = c.SetOutputFormat(composer.OutputJSON); err != nil {
+		t.Errorf("error setting output format: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err == nil {
+		t.Errorf("expected s1 to fail")
+	}
+
+	type record struct {
+		Time     time.Time `json:"time"`
+		Level    string    `json:"level"`
+		Service  string    `json:"service"`
+		Stream   string    `json:"stream"`
+		Line     string    `json:"line"`
+		Event    string    `json:"event"`
+		ExitCode *int      `json:"exit_code"`
+	}
+
+	var records []record
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var r record
+		if err = json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid JSON output line '%s': %v", line, err)
+		}
+		records = append(records, r)
+	}
+
+	want := []record{
+		{Level: "output", Service: "s1", Stream: "stdout", Line: "out"},
+		{Level: "output", Service: "s1", Stream: "stderr", Line: "err"},
+		{Level: "info", Service: "d1", Event: "ready"},
+	}
+
+	for _, w := range want {
+		found := false
+		for _, r := range records {
+			found = found || (r.Level == w.Level && r.Service == w.Service && r.Stream == w.Stream && r.Line == w.Line && r.Event == w.Event)
+		}
+
+		if !found {
+			t.Errorf("expected record %+v not found in output:\n%s", w, output)
+		}
+	}
+
+	for _, r := range records {
+		if r.Time.IsZero() {
+			t.Errorf("expected all records to have time, got: %+v", r)
+		}
+
+		if r.Service == "s1" && r.Event == "exited" && (r.ExitCode == nil || *r.ExitCode != 3) {
+			t.Errorf("expected s1 to exit with code 3, got: %+v", r)
+		}
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	tests := []struct {
+		mode    composer.TimestampMode
+		format  string
+		pattern string
+	}{
+		{mode: composer.TimestampsWall, pattern: `\|\S* \d\d:\d\d:\d\d\.\d\d\d line$`},
+		{mode: composer.TimestampsElapsed, format: "05.000s", pattern: `\|\S* 00\.[0-4]\d\ds line$`},
+		{mode: composer.TimestampsNone, pattern: `\|\S* line$`},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+string(tt.mode), func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "echo line"},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			if err = c.SetTimestamps(tt.mode, tt.format); err != nil {
+				t.Errorf("error setting timestamps: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			if !regexp.MustCompile(`(?m)` + tt.pattern).MatchString(output) {
+				t.Errorf("expected output line matching '%s', got '%s'", tt.pattern, output)
+			}
+		})
+	}
+
+	c, err := composer.New(composer.Config{Version: composer.Version, Services: map[string]composer.ServiceConfig{"s1": {Command: "true"}}}, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	if err = c.SetTimestamps("monotonic", ""); err == nil {
+		t.Errorf("expected unknown timestamps mode error")
+	}
+}
+
+func TestCollapseRepeats(t *testing.T) {
+	tests := []struct {
+		mode composer.CollapseMode
+		want []string
+	}{
+		{mode: composer.CollapseOff, want: []string{"a", "a", "A", "b", "b"}},
+		{mode: composer.CollapseExact, want: []string{"a", "(previous line repeated 1x)", "A", "b", "(previous line repeated 1x)"}},
+		{mode: composer.CollapseCaseInsensitive, want: []string{"a", "(previous line repeated 2x)", "b", "(previous line repeated 1x)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cfg := composer.Config{
+				Version:         composer.Version,
+				CollapseRepeats: tt.mode,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: `printf 'a\na\nA\nb\nb\n'`},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			var got []string
+			for _, line := range strings.Split(output, "\n") {
+				const prefix = "[s1] |\033[0m "
+				if i := strings.Index(line, prefix); i >= 0 {
+					got = append(got, line[i+len(prefix):])
+				}
+			}
+
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("unexpected output lines:\nwant: %q\ngot %q", tt.want, got)
+			}
+		})
+	}
+
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "true", CollapseRepeats: "fuzzy"},
+		},
+	}
+
+	if _, err := composer.New(cfg, []string{"s1"}); err == nil || !strings.Contains(err.Error(), "invalid collapse_repeats") {
+		t.Errorf("expected invalid collapse_repeats error, got: %v", err)
+	}
+}
+
+func TestOutputMux(t *testing.T) {
+	const lines = 20_000
+
+	countLines := func(output, service string) int {
+		count := 0
+		for _, line := range strings.Split(output, "\n") {
+			if strings.Contains(line, "["+service+"]") && strings.Contains(line, service+"-") {
+				count++
+			}
+		}
+		return count
+	}
+
+	tests := []struct {
+		name   string
+		policy composer.OverflowPolicy
+	}{
+		{name: "block", policy: composer.OverflowBlock},
+		{name: "drop", policy: composer.OverflowDrop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {Command: "seq -f 's1-%g' " + strconv.Itoa(lines), DependsOn: []string{"s2"}},
+					"s2": {Command: "seq -f 's2-%g' " + strconv.Itoa(lines) + " && sleep 5", ReadyOn: "s2-" + strconv.Itoa(lines)},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"})
+			if err != nil {
+				t.Errorf("error: %v", err)
+			}
+
+			if err = c.SetOutputBuffer(1, tt.policy); err != nil {
+				t.Errorf("error setting output buffer: %v", err)
+			}
+
+			output := captureStdoutStderr(func() { err = c.Run() })
+			if err != nil {
+				t.Errorf("error running composer: %v", err)
+			}
+
+			dropped := int(c.DroppedOutputLines())
+			if tt.policy == composer.OverflowBlock && dropped != 0 {
+				t.Errorf("expected no dropped lines, got: %d", dropped)
+			}
+
+			if got := countLines(output, "s1") + countLines(output, "s2"); got+dropped != 2*lines {
+				t.Errorf("expected %d lines to be printed or dropped, got %d printed and %d dropped", 2*lines, got, dropped)
+			}
+
+			if dropped > 0 && !strings.Contains(output, "output lines dropped") {
+				t.Errorf("expected dropped lines notice")
+			}
+		})
+	}
+
+	c, err := composer.New(composer.Config{Version: composer.Version, Services: map[string]composer.ServiceConfig{"s1": {Command: "true"}}}, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	if err = c.SetOutputBuffer(0, composer.OverflowBlock); err == nil {
+		t.Errorf("expected invalid buffer size error")
+	}
+
+	if err = c.SetOutputBuffer(10, "discard"); err == nil {
+		t.Errorf("expected unknown overflow policy error")
+	}
+}
+
+type collectingSink struct {
+	lines []composer.OutputLine
+}
+
+func (s *collectingSink) WriteLine(line composer.OutputLine) {
+	s.lines = append(s.lines, line)
+}
+
+func TestOutputSinks(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo out && echo err >&2 && echo err >&2", DependsOn: []string{"d1"}},
+			"d1": {Command: "echo 'd1 up' && sleep 5", ReadyOn: "d1 up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	collected := new(collectingSink)
+	var file, jsonFile bytes.Buffer
+
+	c.SetOutputSinks(collected, composer.NewFileSink(&file, "s1"), composer.NewJSONSink(&jsonFile))
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	if strings.Contains(output, "d1 up") {
+		t.Errorf("expected output lines to be delivered to sinks only, got: '%s'", output)
+	}
+
+	var got []string
+	for _, line := range collected.lines {
+		if line.Time.IsZero() {
+			t.Errorf("expected line to have time: %+v", line)
+		}
+		got = append(got, line.Service+" "+line.Stream+" "+line.Text())
+	}
+
+	// order of stdout and stderr lines of s1 isn't guaranteed
+	sort.Strings(got)
+	want := []string{"d1 stdout d1 up", "s1 stderr (previous line repeated 1x)", "s1 stderr err", "s1 stdout out"}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected collected lines:\nwant: %q\ngot %q", want, got)
+	}
+
+	if !strings.Contains(file.String(), "out\n") || strings.Contains(file.String(), "d1 up") {
+		t.Errorf("expected only s1 lines in file sink, got: '%s'", file.String())
+	}
+
+	if lines := strings.Split(strings.TrimSpace(jsonFile.String()), "\n"); len(lines) != len(want) || !strings.Contains(lines[0], `"service":"d1","stream":"stdout","line":"d1 up"`) {
+		t.Errorf("unexpected JSON sink output: '%s'", jsonFile.String())
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo 's1 up' && sleep 10", ReadyOn: "s1 up"},
+		},
+	}
+
+	var stdout bytes.Buffer
+
+	c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(&stdout), composer.WithSignals())
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err = c.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context error, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected composer to stop when the context is done, took %v", elapsed)
+	}
+
+	if !strings.Contains(stdout.String(), "s1 up") || !strings.Contains(stdout.String(), "Interrupting composer") {
+		t.Errorf("expected output written to stdout option, got: '%s'", stdout.String())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo out && echo err >&2"},
+		},
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	c, err := composer.New(cfg, []string{"s1"},
+		composer.WithStdout(&stdout),
+		composer.WithStderr(&stderr),
+		composer.WithDebug(true),
+		composer.WithOpenFilesLimit(0),
+		composer.WithTimestamps(composer.TimestampsWall, "15:04"),
+	)
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	output := captureStdoutStderr(func() { err = c.Run() })
+	if err != nil {
+		t.Errorf("error running composer: %v", err)
+	}
+
+	if output != "" {
+		t.Errorf("expected nothing written to os.Stdout / os.Stderr, got: '%s'", output)
+	}
+
+	if !strings.Contains(stdout.String(), "[composer-debug]") || !strings.Contains(stdout.String(), " out\n") {
+		t.Errorf("expected debug messages and stdout of s1, got: '%s'", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), " err\n") || strings.Contains(stderr.String(), " out\n") {
+		t.Errorf("expected only stderr of s1, got: '%s'", stderr.String())
+	}
+
+	if _, err = composer.New(cfg, []string{"s1"}, composer.WithOutputFormat("xml")); err == nil {
+		t.Errorf("expected invalid option error")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "echo out && sleep 0.1 && exit 3", DependsOn: []string{"d1"}},
+			"d1": {Command: "echo 'd1 up' && sleep 5", ReadyOn: "d1 up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(io.Discard))
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	events := c.Subscribe()
+
+	received := make(chan []composer.Event)
+	go func() {
+		var result []composer.Event
+		for event := range events {
+			result = append(result, event)
+		}
+		received <- result
+	}()
+
+	if err = c.Run(); err == nil {
+		t.Errorf("expected s1 to fail")
+	}
+
+	var got []string
+	var s1Exit composer.Event
+
+	for _, event := range <-received {
+		if event.Time.IsZero() {
+			t.Errorf("expected event to have time: %+v", event)
+		}
+
+		desc := string(event.Type) + " " + event.Service
+		if event.Type == composer.EventOutput {
+			desc += " " + event.Line.Line
+		}
+		got = append(got, desc)
+
+		if event.Type == composer.EventExited && event.Service == "s1" {
+			s1Exit = event
+		}
+	}
+
+	want := []string{
+		"starting d1",
+		"output d1 d1 up",
+		"ready d1",
+		"starting s1",
+		"ready s1",
+		"output s1 out",
+		"exited s1",
+		"shutdown_started ",
+		"exited d1",
+		"shutdown_completed ",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected events:\nwant: %q\ngot %q", want, got)
+	}
+
+	if s1Exit.ExitCode != 3 || s1Exit.Err == nil || s1Exit.Duration < 100*time.Millisecond {
+		t.Errorf("unexpected exit event of s1: %+v", s1Exit)
+	}
+
+	if _, ok := <-c.Subscribe(); ok {
+		t.Errorf("expected subscription after composer stopped to be closed")
+	}
+}
+
+func TestSubscribe_Restart(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {
+				Command:        "echo up && sleep 0.1 && seq 3000 && sleep 0.1 && exit 1",
+				ReadyOn:        "up",
+				Restart:        composer.RestartOnFailure,
+				MaxRestarts:    1,
+				RestartBackoff: 10 * time.Millisecond,
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(io.Discard))
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	// a subscriber which doesn't receive events must not block composer
+	_ = c.Subscribe()
+	events := c.Subscribe()
+
+	ready := make(chan int)
+	go func() {
+		count := 0
+		for event := range events {
+			if event.Type == composer.EventReady {
+				count++
+			}
+		}
+		ready <- count
+	}()
+
+	if err = c.Run(); err == nil {
+		t.Errorf("expected s1 to fail")
+	}
+
+	if count := <-ready; count != 2 {
+		t.Errorf("expected s1 to be ready twice (before and after the restart), got: %d", count)
+	}
+
+	if c.DroppedEvents() == 0 {
+		t.Errorf("expected events of the blocked subscriber to be dropped")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		ready     composer.ServiceConfig
+		interrupt bool
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name:    "exit code",
+			command: "exit 3",
+			check: func(t *testing.T, err error) {
+				var exitErr *composer.ServiceExitError
+				if !errors.As(err, &exitErr) || exitErr.Service != "s1" || exitErr.ExitCode != 3 || exitErr.Signal != 0 {
+					t.Errorf("expected exit error of s1 with code 3, got: %#v", err)
+				}
+			},
+		},
+		{
+			name:    "signal",
+			command: "kill -9 $$",
+			check: func(t *testing.T, err error) {
+				var exitErr *composer.ServiceExitError
+				if !errors.As(err, &exitErr) || exitErr.ExitCode != -1 || exitErr.Signal != syscall.SIGKILL {
+					t.Errorf("expected exit error of s1 killed by SIGKILL, got: %#v", err)
+				}
+			},
+		},
+		{
+			name:    "ready timeout",
+			command: "echo starting && sleep 5",
+			ready:   composer.ServiceConfig{ReadyOn: "started", ReadyTimeout: time.Second},
+			check: func(t *testing.T, err error) {
+				var timeoutErr *composer.ReadinessTimeoutError
+				if !errors.As(err, &timeoutErr) || timeoutErr.Service != "s1" || timeoutErr.Timeout != time.Second {
+					t.Errorf("expected ready timeout error of s1, got: %#v", err)
+				}
+
+				if timeoutErr != nil && !reflect.DeepEqual(timeoutErr.Output, []string{"starting"}) {
+					t.Errorf("expected last output of s1, got: %q", timeoutErr.Output)
+				}
+			},
+		},
+		{
+			name:      "interrupted",
+			command:   "sleep 5",
+			interrupt: true,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, composer.ErrInterrupted) {
+					t.Errorf("expected interrupted error, got: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := tt.ready
+			svc.Command = tt.command
+
+			cfg := composer.Config{
+				Version:  composer.Version,
+				Services: map[string]composer.ServiceConfig{"s1": svc},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(io.Discard), composer.WithSignals())
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+
+			if tt.interrupt {
+				time.AfterFunc(200*time.Millisecond, c.Interrupt)
+			}
+
+			tt.check(t, c.Run())
+		})
+	}
+}
+
+func TestSignals(t *testing.T) {
+	tests := []struct {
+		name       string
+		signal     syscall.Signal
+		wantOutput string
+	}{
+		{name: "terminate", signal: syscall.SIGTERM},
+		{name: "forward", signal: syscall.SIGUSR1, wantOutput: "got usr1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := composer.Config{
+				Version: composer.Version,
+				Services: map[string]composer.ServiceConfig{
+					"s1": {
+						Command:        "trap 'echo got usr1' USR1; echo up; while true; do sleep 0.1; done",
+						ReadyOn:        "up",
+						ForwardSignals: []string{"SIGUSR1"},
+					},
+				},
+			}
+
+			c, err := composer.New(cfg, []string{"s1"}, composer.WithStdout(io.Discard))
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+
+			events := c.Subscribe()
+			exited := make(chan bool, 1)
+
+			go func() {
+				defer close(exited)
+
+				for event := range events {
+					switch {
+					case event.Type == composer.EventReady:
+						_ = syscall.Kill(os.Getpid(), tt.signal)
+					case event.Type == composer.EventOutput && event.Line.Line == tt.wantOutput:
+						c.Interrupt()
+					case event.Type == composer.EventExited:
+						exited <- true
+					}
+				}
+			}()
+
+			timer := time.AfterFunc(5*time.Second, c.Interrupt)
+			defer timer.Stop()
+
+			start := time.Now()
+
+			if err = c.Run(); !errors.Is(err, composer.ErrInterrupted) {
+				t.Errorf("expected interrupted error, got: %v", err)
+			}
+
+			if time.Since(start) > 3*time.Second {
+				t.Errorf("composer should stop right after the signal, it took %v instead", time.Since(start))
+			}
+
+			if !<-exited {
+				t.Errorf("expected s1 to be stopped")
+			}
+		})
+	}
+}
@@ -50,6 +50,35 @@ type Config struct {
 	// It's possible to use $KEY notation, to use KEY value from current environment.
 	Environment Environment `yaml:"environment"`
 
+	// ReadyTimeout defines default maximum duration of waiting for a service to be ready (i.e. 30s, 2m).
+	// It's used for services which don't define their own ReadyTimeout.
+	// If not set, composer will wait indefinitely.
+	ReadyTimeout time.Duration `yaml:"ready_timeout"`
+
+	// BeforeAll defines a command executed before any service is started.
+	// When the command fails, no service is started.
+	BeforeAll string `yaml:"before_all"`
+
+	// AfterAll defines a command executed after all services are stopped.
+	AfterAll string `yaml:"after_all"`
+
+	// LogDir defines a directory where output of each service is written to (into <service>.log file),
+	// unless the service defines its own LogFile.
+	LogDir string `yaml:"log_dir"`
+
+	// LogMaxSize defines maximum size of a log file before it's rotated (i.e. 512KB or 10MB).
+	// If not set, default of 10MB will be used.
+	LogMaxSize ByteSize `yaml:"log_max_size"`
+
+	// LogMaxFiles defines how many rotated log files are kept (besides the current one).
+	// If not set, default of 5 will be used.
+	LogMaxFiles int `yaml:"log_max_files"`
+
+	// CollapseRepeats defines default mode of collapsing repeated output lines (off, exact or case-insensitive).
+	// It's used for services which don't define their own CollapseRepeats.
+	// If not set, case-insensitive will be used.
+	CollapseRepeats CollapseMode `yaml:"collapse_repeats"`
+
 	// Services defines a map of service name to its configuration
 	Services map[string]ServiceConfig `yaml:"services"`
 }
@@ -167,6 +196,12 @@ type ServiceConfig struct {
 	// Command defines which program to execute to start the service (REQUIRED).
 	Command string `yaml:"command"`
 
+	// Type defines whether the service is a long-running service or a one-shot task (service or task).
+	// Services depending on a task are started only after the task exits successfully,
+	// and the task's failure stops composer.
+	// If not set, the service is a long-running service.
+	Type ServiceType `yaml:"type"`
+
 	// Workdir defines working directory where the Command will be executed.
 	// When empty, Command will run in the current working directory.
 	Workdir string `yaml:"workdir"`
@@ -175,6 +210,24 @@ type ServiceConfig struct {
 	// When empty, services will be deemed ready immediately after start.
 	ReadyOn string `yaml:"ready_on"`
 
+	// ReadyOnRegex defines a regular expression for stdout/stderr which determines whether the service is ready or not.
+	// Values of named capture groups are available to dependent services as environmental variables
+	// named SERVICE_<SERVICE>_<GROUP> (i.e. "port (?P<port>\d+)" of service "db" exports SERVICE_DB_PORT).
+	ReadyOnRegex string `yaml:"ready_on_regex"`
+
+	// ReadyCheck defines an active check which determines whether the service is ready or not.
+	// It's an alternative to ReadyOn for services which don't print anything when they are ready.
+	ReadyCheck *ReadyCheck `yaml:"ready_check"`
+
+	// LivenessCheck defines a check which is periodically performed once the service is ready.
+	// When the service becomes unhealthy, it's restarted or composer is stopped (see LivenessCheck.OnFailure).
+	LivenessCheck *LivenessCheck `yaml:"liveness_check"`
+
+	// ReadyTimeout defines maximum duration of waiting for the service to be ready (i.e. 30s, 2m).
+	// When exceeded, composer stops all services and fails.
+	// If not set, the global ReadyTimeout will be used.
+	ReadyTimeout time.Duration `yaml:"ready_timeout"`
+
 	// DependsOn defines which other services should be started before this one.
 	// When empty, service can start immediately.
 	DependsOn []string `yaml:"depends_on"`
@@ -187,6 +240,203 @@ type ServiceConfig struct {
 	// KillTimeout defines maximum allowed duration for the process to shut down gracefully (before KILL signal is sent)
 	// If not set, default of 5 seconds will be used.
 	KillTimeout int `yaml:"kill_timeout"`
+
+	// LogFile defines a file where raw output (stdout and stderr) of the service is written to (besides the terminal).
+	// The file is rotated according to the global LogMaxSize and LogMaxFiles.
+	// If not set, <LogDir>/<service>.log will be used when the global LogDir is set.
+	LogFile string `yaml:"log_file"`
+
+	// CollapseRepeats defines how repeated output lines are collapsed (off, exact or case-insensitive).
+	// Instead of repeated lines, a summary with number of repeats is printed (log files always get all lines).
+	// If not set, the global CollapseRepeats will be used.
+	CollapseRepeats CollapseMode `yaml:"collapse_repeats"`
+
+	// StopSignal defines a signal sent to the service's processes to shut it down gracefully (i.e. SIGTERM, SIGQUIT).
+	// If not set, SIGINT will be used.
+	StopSignal string `yaml:"stop_signal"`
+
+	// ForwardSignals defines signals received by composer which are forwarded to the service's processes
+	// (i.e. SIGUSR1 or SIGHUP to reload its configuration). Forwarded signals don't interrupt composer.
+	// If not set, no signals are forwarded.
+	ForwardSignals []string `yaml:"forward_signals"`
+
+	// PreStart defines a command executed before the service's Command is started (including restarts).
+	// When the command fails, the service is not started.
+	PreStart string `yaml:"pre_start"`
+
+	// PostStart defines a command executed right after the service's Command is started (including restarts).
+	PostStart string `yaml:"post_start"`
+
+	// OnReady defines a command executed once the service is ready (i.e. to seed a database).
+	// Dependent services are started only after the command succeeds, when it fails, composer stops.
+	OnReady string `yaml:"on_ready"`
+
+	// PreStop defines a command executed before the service is signalled to stop (i.e. to drain its workers).
+	// It must finish within KillTimeout.
+	PreStop string `yaml:"pre_stop"`
+
+	// PostStop defines a command executed after the service's Command exits (i.e. to clean temporary files).
+	// It must finish within KillTimeout.
+	PostStop string `yaml:"post_stop"`
+
+	// OnFailure defines a command executed after the service's Command exits with an error
+	// (unless it was stopped by composer). It must finish within KillTimeout.
+	OnFailure string `yaml:"on_failure"`
+
+	// All hook commands above are executed with the service's environment and workdir.
+
+	// Restart defines whether the service should be restarted when it exits (no, on-failure or always).
+	// Other services keep running while the service is being restarted.
+	// If not set, the service is never restarted and its exit stops composer.
+	Restart RestartPolicy `yaml:"restart"`
+
+	// MaxRestarts defines maximum number of restarts after which the service's exit stops composer.
+	// If not set, the service can be restarted indefinitely.
+	MaxRestarts int `yaml:"max_restarts"`
+
+	// RestartBackoff defines a delay before the first restart (i.e. 500ms, 2s).
+	// The delay doubles with every consecutive crash (see MinUptime).
+	// If not set, default of 1 second will be used.
+	RestartBackoff time.Duration `yaml:"restart_backoff"`
+
+	// RestartBackoffMax defines maximum delay before a restart (i.e. 10s, 1m).
+	// If not set, default of 30 seconds will be used.
+	RestartBackoffMax time.Duration `yaml:"restart_backoff_max"`
+
+	// MinUptime defines how long the service must run, so its exit is not considered a crash (i.e. 10s, 1m).
+	// Running for at least MinUptime resets the restart delay and the crash counter.
+	// If not set, default of 10 seconds will be used.
+	MinUptime time.Duration `yaml:"min_uptime"`
+
+	// CrashLoopLimit defines how many consecutive crashes are allowed before composer gives up on the service.
+	// If not set, default of 5 crashes will be used.
+	CrashLoopLimit int `yaml:"crash_loop_limit"`
+}
+
+// ServiceType defines what kind of program a service runs
+type ServiceType string
+
+const (
+	ServiceTypeService ServiceType = "service"
+	ServiceTypeTask    ServiceType = "task"
+)
+
+// CollapseMode defines which consecutive output lines are considered repeated
+type CollapseMode string
+
+const (
+	CollapseOff             CollapseMode = "off"
+	CollapseExact           CollapseMode = "exact"
+	CollapseCaseInsensitive CollapseMode = "case-insensitive"
+)
+
+// RestartPolicy defines when a service should be restarted
+type RestartPolicy string
+
+const (
+	RestartNo        RestartPolicy = "no"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartBackoffMax = 30 * time.Second
+	DefaultMinUptime         = 10 * time.Second
+	DefaultCrashLoopLimit    = 5
+)
+
+const (
+	DefaultCheckInterval = time.Second
+	DefaultCheckTimeout  = time.Second
+)
+
+// Check defines a kind of check performed against a service.
+// Exactly one kind of check must be defined.
+type Check struct {
+	// HTTP defines an HTTP endpoint which must respond with an expected status code.
+	HTTP *HTTPCheck `yaml:"http"`
+
+	// TCP defines an address (host:port) which must accept TCP connections.
+	// Like HTTPCheck.URL, it's possible to use $KEY notation.
+	TCP string `yaml:"tcp"`
+
+	// Unix defines a path to a Unix domain socket which must accept connections.
+	// Like HTTPCheck.URL, it's possible to use $KEY notation.
+	Unix string `yaml:"unix"`
+
+	// Command defines a program which must exit successfully (with 0 exit code).
+	// It's executed with the service's environment and workdir.
+	Command string `yaml:"command"`
+}
+
+// ReadyCheck defines how to check whether a service is ready
+type ReadyCheck struct {
+	Check `yaml:",inline"`
+
+	// Interval defines how long to wait between two check attempts (i.e. 500ms, 2s).
+	// If not set, default of 1 second will be used.
+	Interval time.Duration `yaml:"interval"`
+
+	// Timeout defines maximum allowed duration of a single check attempt (i.e. 500ms, 2s).
+	// If not set, default of 1 second will be used.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Attempts defines maximum number of check attempts before the service is deemed to have failed.
+	// If not set, the check will be repeated until it succeeds.
+	Attempts int `yaml:"attempts"`
+}
+
+const (
+	DefaultLivenessCheckPeriod           = 10 * time.Second
+	DefaultLivenessCheckFailureThreshold = 3
+)
+
+// LivenessCheck defines how to check whether a ready service is still healthy
+type LivenessCheck struct {
+	Check `yaml:",inline"`
+
+	// Period defines how long to wait between two checks (i.e. 5s, 1m).
+	// If not set, default of 10 seconds will be used.
+	Period time.Duration `yaml:"period"`
+
+	// Timeout defines maximum allowed duration of a single check (i.e. 500ms, 2s).
+	// If not set, default of 1 second will be used.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// FailureThreshold defines how many consecutive checks must fail before the service is deemed unhealthy.
+	// If not set, default of 3 failures will be used.
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// OnFailure defines what happens to an unhealthy service (restart or abort).
+	// If not set, the service is restarted (regardless of its restart policy).
+	OnFailure LivenessAction `yaml:"on_failure"`
+}
+
+// LivenessAction defines what happens when a service fails its liveness check
+type LivenessAction string
+
+const (
+	LivenessRestart LivenessAction = "restart"
+	LivenessAbort   LivenessAction = "abort"
+)
+
+const (
+	DefaultHTTPCheckMinStatus = 200
+	DefaultHTTPCheckMaxStatus = 399
+)
+
+// HTTPCheck defines an HTTP GET request check
+type HTTPCheck struct {
+	// URL defines an address to be requested (REQUIRED).
+	// It's possible to use $KEY notation, to use KEY value from the service's environment
+	// (including variables exported by its dependencies, falling back to composer's own environment).
+	URL string `yaml:"url"`
+
+	// MinStatus and MaxStatus define an inclusive range of response status codes considered successful.
+	// If not set, any status between 200 and 399 will be accepted.
+	MinStatus int `yaml:"min_status"`
+	MaxStatus int `yaml:"max_status"`
 }
 
 // Environment defines map of environmental keys to variables
@@ -0,0 +1,158 @@
+package composer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Control commands accepted on the control socket
+const (
+	ControlStatus  = "status"
+	ControlRestart = "restart"
+	ControlStop    = "stop"
+	ControlStart   = "start"
+	ControlLogs    = "logs"
+)
+
+// ControlRequest defines a request sent to the control socket of a running composer
+type ControlRequest struct {
+	Command string `json:"command"`
+	Service string `json:"service,omitempty"`
+	// Cascade makes the restart command restart also services depending on the service
+	Cascade bool `json:"cascade,omitempty"`
+	// Lines limits number of output lines returned by the logs command (all kept lines by default)
+	Lines int `json:"lines,omitempty"`
+}
+
+// ControlResponse defines a response to ControlRequest
+type ControlResponse struct {
+	Error    string          `json:"error,omitempty"`
+	Services []ServiceStatus `json:"services,omitempty"`
+	Lines    []string        `json:"lines,omitempty"`
+}
+
+// SocketPath returns a path of the control socket for the project of the config.
+// The socket is placed in $XDG_RUNTIME_DIR (when set) or in the project directory.
+func SocketPath(cfg Config) string {
+	dir := cfg.Environment["PWD"]
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		hash := sha256.Sum256([]byte(dir))
+		return filepath.Join(runtimeDir, fmt.Sprintf("composer-%x.sock", hash[:8]))
+	}
+
+	return filepath.Join(dir, ".composer.sock")
+}
+
+// EnableControlSocket makes composer accept control requests on the Unix domain socket (see SocketPath)
+func (c *Composer) EnableControlSocket(path string) {
+	c.socketPath = path
+}
+
+// Control sends the request to composer listening on the control socket and returns its response
+func Control(socketPath string, req ControlRequest) (*ControlResponse, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to composer: %w", err)
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("cannot send request: %w", err)
+	}
+
+	resp := new(ControlResponse)
+	if err = json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("cannot read response: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *Composer) listenControlSocket() (net.Listener, error) {
+	if _, err := os.Stat(c.socketPath); err == nil {
+		// a socket which doesn't accept connections is left over by a composer which didn't exit cleanly
+		if conn, err := net.Dial("unix", c.socketPath); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("another composer is listening on %s", c.socketPath)
+		}
+
+		if err = os.Remove(c.socketPath); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", c.socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.debug("listening on control socket %s", c.socketPath)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go c.handleControlConn(conn)
+		}
+	}()
+
+	return listener, nil
+}
+
+func (c *Composer) handleControlConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	var req ControlRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		_ = json.NewEncoder(conn).Encode(ControlResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	c.debug("control request: %+v", req)
+
+	resp, err := c.control(req)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+func (c *Composer) control(req ControlRequest) (ControlResponse, error) {
+	switch req.Command {
+	case ControlStatus:
+		return ControlResponse{Services: c.Status()}, nil
+	case ControlRestart:
+		return ControlResponse{}, c.restart(req.Service, req.Cascade)
+	case ControlStop:
+		return ControlResponse{}, c.requestStop(req.Service)
+	case ControlStart:
+		return ControlResponse{}, c.requestStart(req.Service)
+	case ControlLogs:
+		service, err := c.findService(req.Service)
+		if err != nil {
+			return ControlResponse{}, err
+		}
+
+		lines := req.Lines
+		if lines <= 0 {
+			lines = outputTailSize
+		}
+
+		return ControlResponse{Lines: service.output.last(lines)}, nil
+	default:
+		return ControlResponse{}, fmt.Errorf("unknown command: %s", req.Command)
+	}
+}
@@ -0,0 +1,262 @@
+package composer_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/t12y/composer/composer"
+)
+
+func TestControl(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "composer.sock")
+
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 10", DependsOn: []string{"w1"}},
+			"w1": {Command: "echo 'w1 up' && sleep 10", ReadyOn: "w1 up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	c.EnableControlSocket(socketPath)
+
+	control := func(command, service string) *composer.ControlResponse {
+		resp, err := composer.Control(socketPath, composer.ControlRequest{Command: command, Service: service})
+		if err != nil {
+			t.Fatalf("control request %s %s failed: %v", command, service, err)
+		}
+		return resp
+	}
+
+	w1Status := func() composer.ServiceStatus {
+		for _, status := range control(composer.ControlStatus, "").Services {
+			if status.Name == "w1" {
+				return status
+			}
+		}
+		t.Fatalf("status of w1 not found")
+		return composer.ServiceStatus{}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run()
+	}()
+
+	// wait for all services to start
+	time.Sleep(500 * time.Millisecond)
+
+	if status := w1Status(); status.State != composer.StateReady || status.PID == 0 {
+		t.Errorf("expected w1 to be running, got: %+v", status)
+	}
+
+	if lines := control(composer.ControlLogs, "w1").Lines; len(lines) != 1 || lines[0] != "w1 up" {
+		t.Errorf("expected w1 logs, got: %v", lines)
+	}
+
+	if resp := control(composer.ControlStop, "w1"); resp.Error != "" {
+		t.Errorf("error stopping w1: %s", resp.Error)
+	}
+
+	if status := w1Status(); status.State != composer.StateStopped {
+		t.Errorf("expected w1 to be stopped, got: %+v", status)
+	}
+
+	if resp := control(composer.ControlStart, "w1"); resp.Error != "" {
+		t.Errorf("error starting w1: %s", resp.Error)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if status := w1Status(); status.State != composer.StateReady {
+		t.Errorf("expected w1 to be running again, got: %+v", status)
+	}
+
+	if resp := control(composer.ControlRestart, "w1"); resp.Error != "" {
+		t.Errorf("error restarting w1: %s", resp.Error)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if status := w1Status(); status.State != composer.StateReady || status.Restarts != 1 {
+		t.Errorf("expected w1 to be running after a restart, got: %+v", status)
+	}
+
+	if resp := control(composer.ControlStart, "unknown"); !strings.Contains(resp.Error, "unknown service") {
+		t.Errorf("expected unknown service error, got: %+v", resp)
+	}
+
+	c.Interrupt()
+
+	if err = <-done; err == nil || !strings.Contains(err.Error(), "interrupted by user") {
+		t.Errorf("error running composer: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 0.2 && exit 3", DependsOn: []string{"w1"}},
+			"w1": {Command: "echo 'w1 up' && sleep 10", ReadyOn: "w1 up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	for _, status := range c.Status() {
+		if status.State != composer.StatePending || status.ExitCode != nil {
+			t.Errorf("expected %s to be pending, got: %+v", status.Name, status)
+		}
+	}
+
+	if err = c.Run(); err == nil {
+		t.Errorf("expected s1 to fail")
+	}
+
+	for _, status := range c.Status() {
+		switch status.Name {
+		case "s1":
+			if status.State != composer.StateFailed || status.ExitCode == nil || *status.ExitCode != 3 {
+				t.Errorf("expected s1 to fail with exit code 3, got: %+v", status)
+			}
+		case "w1":
+			if status.State != composer.StateExited || status.ReadyAt.Before(status.StartedAt) || status.ReadyAt.IsZero() {
+				t.Errorf("expected w1 to be ready and exit, got: %+v", status)
+			}
+		}
+	}
+}
+
+func TestRestartWithDependents(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 10", DependsOn: []string{"w1"}},
+			"w1": {Command: "sleep 0.2 && echo 'w1 up' && sleep 10", ReadyOn: "w1 up", DependsOn: []string{"db"}},
+			"db": {Command: "echo 'db up' && sleep 10", ReadyOn: "db up"},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	startedAt := make(map[string]time.Time)
+	restarts := func() map[string]int {
+		result := make(map[string]int)
+		for _, status := range c.Status() {
+			if status.State != composer.StateReady {
+				t.Errorf("expected %s to be ready, got: %+v", status.Name, status)
+			}
+			result[status.Name] = status.Restarts
+			startedAt[status.Name] = status.StartedAt
+		}
+		return result
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run()
+	}()
+
+	// wait for all services to start
+	time.Sleep(500 * time.Millisecond)
+
+	if err = c.Restart("w1"); err != nil {
+		t.Errorf("error restarting w1: %v", err)
+	}
+
+	if r := restarts(); r["w1"] != 1 || r["s1"] != 0 || r["db"] != 0 {
+		t.Errorf("expected only w1 to be restarted, got: %v", r)
+	}
+
+	s1StartedAt := startedAt["s1"]
+
+	if err = c.RestartWithDependents("db"); err != nil {
+		t.Errorf("error restarting db: %v", err)
+	}
+
+	// dependents are stopped and started again (which doesn't count as a restart)
+	if r := restarts(); r["w1"] != 1 || r["s1"] != 0 || r["db"] != 1 {
+		t.Errorf("expected db to be restarted, got: %v", r)
+	}
+
+	if !startedAt["s1"].After(s1StartedAt) {
+		t.Errorf("expected s1 to be started again")
+	}
+
+	if err = c.Restart("unknown"); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("expected unknown service error, got: %v", err)
+	}
+
+	c.Interrupt()
+
+	if err = <-done; err == nil || !strings.Contains(err.Error(), "interrupted by user") {
+		t.Errorf("error running composer: %v", err)
+	}
+}
+
+func TestRestart_FailedDependency(t *testing.T) {
+	cfg := composer.Config{
+		Version: composer.Version,
+		Services: map[string]composer.ServiceConfig{
+			"s1": {Command: "sleep 10", DependsOn: []string{"w1"}},
+			// w1 fails on the first run (after it's ready) and keeps running on the next one
+			"w1": {
+				Command: "if [ -f ran ]; then echo 'w1 up' && sleep 10; else touch ran && echo 'w1 up' && sleep 0.2 && exit 1; fi",
+				ReadyOn: "w1 up",
+				Workdir: t.TempDir(),
+			},
+		},
+	}
+
+	c, err := composer.New(cfg, []string{"s1"})
+	if err != nil {
+		t.Errorf("error: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run()
+	}()
+
+	// wait for w1 to fail
+	time.Sleep(500 * time.Millisecond)
+
+	for _, status := range c.Status() {
+		if status.Name == "w1" && status.State != composer.StateFailed {
+			t.Errorf("expected w1 to fail, got: %+v", status)
+		}
+	}
+
+	if err = c.Restart("w1"); err != nil {
+		t.Errorf("error restarting w1: %v", err)
+	}
+
+	for _, status := range c.Status() {
+		if status.State != composer.StateReady {
+			t.Errorf("expected %s to be ready, got: %+v", status.Name, status)
+		}
+		if status.Name == "w1" && status.Restarts != 1 {
+			t.Errorf("expected w1 to be restarted once, got: %+v", status)
+		}
+	}
+
+	c.Interrupt()
+
+	if err = <-done; err == nil || !strings.Contains(err.Error(), "interrupted by user") {
+		t.Errorf("error running composer: %v", err)
+	}
+}
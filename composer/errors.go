@@ -0,0 +1,79 @@
+package composer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInterrupted is returned by Run when composer is interrupted (by a signal or by calling Interrupt)
+var ErrInterrupted = errors.New("interrupted by user")
+
+// ServiceExitError is returned by Run when a service (or a task) exits with an error
+type ServiceExitError struct {
+	Service string
+	// Task is set when the service is a task
+	Task bool
+	// ExitCode is -1 when the service was killed by a signal (or its exit status is unknown)
+	ExitCode int
+	// Signal is set when the service was killed by a signal
+	Signal syscall.Signal
+	// Err is the original error returned when waiting for the service's command
+	Err error
+}
+
+func (e *ServiceExitError) Error() string {
+	if e.Task {
+		return fmt.Sprintf("task %s failed: %v", e.Service, e.Err)
+	}
+
+	return fmt.Sprintf("service %s exited with: %v", e.Service, e.Err)
+}
+
+func (e *ServiceExitError) Unwrap() error {
+	return e.Err
+}
+
+// newServiceExitError describes an exit of the service's command with err (nil is returned for successful exits)
+func newServiceExitError(service *Service, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	exitErr := &ServiceExitError{
+		Service:  service.name,
+		Task:     service.isTask,
+		ExitCode: exitCode(err),
+		Err:      err,
+	}
+
+	var cmdErr *exec.ExitError
+	if errors.As(err, &cmdErr) {
+		if status, ok := cmdErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exitErr.Signal = status.Signal()
+		}
+	}
+
+	return exitErr
+}
+
+// ReadinessTimeoutError is returned by Run when a service isn't ready within its ready timeout
+type ReadinessTimeoutError struct {
+	Service string
+	Timeout time.Duration
+	// Output holds the last lines of the service's output
+	Output []string
+}
+
+func (e *ReadinessTimeoutError) Error() string {
+	msg := fmt.Sprintf("service %s not ready after %v", e.Service, e.Timeout)
+
+	if len(e.Output) == 0 {
+		return fmt.Sprintf("%s (no output)", msg)
+	}
+
+	return fmt.Sprintf("%s, last output:\n  %s", msg, strings.Join(e.Output, "\n  "))
+}
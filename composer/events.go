@@ -0,0 +1,122 @@
+package composer
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType defines a kind of Event
+type EventType string
+
+const (
+	// EventStarting is emitted when a service is being started (or started again after it was stopped)
+	EventStarting EventType = "starting"
+	// EventReady is emitted when a service becomes ready (or a task completes successfully)
+	EventReady EventType = "ready"
+	// EventOutput is emitted for every output line of a service (see Event.Line)
+	EventOutput EventType = "output"
+	// EventExited is emitted when a service exits (see Event.ExitCode, Event.Err and Event.Duration)
+	EventExited EventType = "exited"
+	// EventRestarting is emitted when a service is going to be restarted
+	EventRestarting EventType = "restarting"
+	// EventStopped is emitted when a service is stopped on request (see ControlStop)
+	EventStopped EventType = "stopped"
+	// EventShutdownStarted is emitted when composer starts stopping all services
+	EventShutdownStarted EventType = "shutdown_started"
+	// EventShutdownCompleted is emitted when composer finished running, it's the last event
+	EventShutdownCompleted EventType = "shutdown_completed"
+)
+
+// DefaultSubscriptionBuffer defines how many events can be buffered for a subscriber
+const DefaultSubscriptionBuffer = 1024
+
+// Event describes a change of a service (or of composer) observed by subscribers
+type Event struct {
+	Type EventType
+	// Service is empty for events of composer (shutdown)
+	Service string
+	Time    time.Time
+	// Line is set for EventOutput
+	Line OutputLine
+	// ExitCode, Err (nil for successful exits) and Duration (for how long the service was running)
+	// are set for EventExited
+	ExitCode int
+	Err      error
+	Duration time.Duration
+}
+
+// subscriptions delivers events to subscribers without blocking composer
+type subscriptions struct {
+	lock        sync.Mutex
+	subscribers []chan Event
+	closed      bool
+	// dropped counts events not delivered to subscribers which didn't keep up
+	dropped uint64
+}
+
+// Subscribe returns a channel receiving events of composer and its services, it's closed after EventShutdownCompleted.
+// Events never block composer (nor its output): once DefaultSubscriptionBuffer events are buffered
+// for a subscriber, further events are dropped for it (see DroppedEvents).
+// Subscribing after composer finished running returns a closed channel.
+func (c *Composer) Subscribe() <-chan Event {
+	s := c.subscriptions
+	ch := make(chan Event, DefaultSubscriptionBuffer)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		close(ch)
+		return ch
+	}
+
+	s.subscribers = append(s.subscribers, ch)
+
+	return ch
+}
+
+// DroppedEvents returns how many events were dropped because subscribers didn't keep up
+func (c *Composer) DroppedEvents() uint64 {
+	s := c.subscriptions
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dropped
+}
+
+// emit delivers the event to all subscribers, it's dropped for subscribers with a full buffer
+func (s *subscriptions) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// close closes channels of all subscribers
+func (s *subscriptions) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, ch := range s.subscribers {
+		close(ch)
+	}
+
+	s.subscribers = nil
+	s.closed = true
+}
+
+// shutdownCompleted prints the last message of composer (the event is emitted before subscribers are closed)
+func (c *Composer) shutdownCompleted() {
+	c.globalEvent(EventShutdownCompleted, "Composer stopped")
+}
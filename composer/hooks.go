@@ -0,0 +1,101 @@
+package composer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// runCommand runs the command until it exits or the context is done
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		// kill the whole process group, so no subprocess outlives the command
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return ctx.Err()
+	}
+}
+
+type serviceHooks struct {
+	preStart  string
+	postStart string
+	onReady   string
+	preStop   string
+	postStop  string
+	onFailure string
+}
+
+// runServiceHook runs the service's hook command (with the service's environment and workdir) until the context is done.
+// When timeout is 0, the command can run indefinitely.
+func (c *Composer) runServiceHook(ctx context.Context, service *Service, hook, command string, timeout time.Duration) error {
+	if command == "" {
+		return nil
+	}
+
+	log := func(msg string, args ...interface{}) {
+		c.serviceInfo(service, msg, args...)
+	}
+
+	return c.runHook(ctx, hook, service.newCmd(command), timeout, log)
+}
+
+// runGlobalHook runs the hook command with the global environment
+func (c *Composer) runGlobalHook(hook, command string) error {
+	if command == "" {
+		return nil
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	for key, value := range c.cfg.Environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, os.ExpandEnv(value)))
+	}
+
+	return c.runHook(context.Background(), hook, cmd, 0, c.info)
+}
+
+// runHook runs the hook command (until the context is done) and prints its output with the log function
+func (c *Composer) runHook(ctx context.Context, hook string, cmd *exec.Cmd, timeout time.Duration, log func(msg string, args ...interface{})) error {
+	log("running %s hook", hook)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	err := runCommand(ctx, cmd)
+
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		log("%s: %s", hook, scanner.Text())
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+
+	return nil
+}
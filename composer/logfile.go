@@ -0,0 +1,184 @@
+package composer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultLogMaxSize  = 10 * MB
+	DefaultLogMaxFiles = 5
+)
+
+// ByteSize defines a size in bytes, in config it can be specified with a unit (i.e. 512KB, 10MB or 1GB)
+type ByteSize int64
+
+const (
+	B  ByteSize = 1
+	KB          = 1024 * B
+	MB          = 1024 * KB
+	GB          = 1024 * MB
+)
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	// longer suffixes must go first, so "B" doesn't match "KB"
+	{"KB", KB},
+	{"MB", MB},
+	{"GB", GB},
+	{"B", B},
+}
+
+// ParseByteSize parses a size with an optional unit (B, KB, MB or GB), i.e. 10MB
+func ParseByteSize(value string) (ByteSize, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	unit := B
+
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	return ByteSize(n) * unit, nil
+}
+
+// UnmarshalYAML parses ByteSize defined in config
+func (s *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+
+	*s = size
+
+	return nil
+}
+
+// logFile is a file rotated once it would exceed maxSize.
+// Rotated files are renamed to <path>.1, <path>.2, ... (up to maxFiles, the oldest file is removed).
+type logFile struct {
+	path     string
+	maxSize  ByteSize
+	maxFiles int
+
+	lock sync.Mutex
+	file *os.File
+	size ByteSize
+}
+
+func newLogFile(path string, maxSize ByteSize, maxFiles int) *logFile {
+	if maxSize == 0 {
+		maxSize = DefaultLogMaxSize
+	}
+
+	if maxFiles == 0 {
+		maxFiles = DefaultLogMaxFiles
+	}
+
+	return &logFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// open opens the file for appending (creating it and its directory when needed)
+func (f *logFile) open() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("cannot create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+
+	f.file = file
+	f.size = ByteSize(info.Size())
+
+	return nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && f.size+ByteSize(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += ByteSize(n)
+
+	return n, err
+}
+
+// rotate shifts rotated files and starts a new file (lock must be held by the caller)
+func (f *logFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	f.file = nil
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))
+
+	for i := f.maxFiles - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return fmt.Errorf("cannot rotate log file: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+
+	f.file = file
+	f.size = 0
+
+	return nil
+}
+
+func (f *logFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
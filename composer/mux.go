@@ -0,0 +1,214 @@
+package composer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy defines what happens to output lines of services when the output buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes services wait until there is space in the buffer (default)
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDrop drops output lines (and reports how many lines were dropped)
+	OverflowDrop OverflowPolicy = "drop"
+)
+
+// DefaultOutputBufferSize defines a default number of lines buffered by the output multiplexer
+const DefaultOutputBufferSize = 4096
+
+// outputBatchSize limits number of entries written at once
+const outputBatchSize = 256
+
+// outputEntry defines either complete lines of output to be written to the writer,
+// or a line of a service's output to be delivered to sinks
+type outputEntry struct {
+	writer io.Writer
+	data   []byte
+	line   *OutputLine
+}
+
+// outputMux serializes output of all services and composer, so lines are never interleaved
+// and a slow terminal doesn't block reading output of services (unless the buffer is full).
+// Until it's started (and after it's stopped), output is written directly.
+// Lines of services are delivered to sinks, which are flushed after each batch.
+type outputMux struct {
+	// dropped counts entries dropped since the last notice, totalDropped counts all dropped entries
+	dropped      uint64
+	totalDropped uint64
+
+	bufferSize int
+	policy     OverflowPolicy
+	// notice returns an entry reporting number of dropped entries
+	notice func(dropped uint64) outputEntry
+	sinks  []OutputSink
+
+	lock    sync.RWMutex
+	entries chan outputEntry
+	done    chan struct{}
+	// directLock serializes output written directly (when the multiplexer isn't running)
+	directLock sync.Mutex
+}
+
+func newOutputMux(notice func(dropped uint64) outputEntry) *outputMux {
+	return &outputMux{
+		bufferSize: DefaultOutputBufferSize,
+		policy:     OverflowBlock,
+		notice:     notice,
+	}
+}
+
+// SetOutputBuffer defines how many output lines can be buffered before they are written
+// and what happens to output lines of services when the buffer is full.
+func (c *Composer) SetOutputBuffer(size int, policy OverflowPolicy) error {
+	if size <= 0 {
+		return fmt.Errorf("output buffer size must be positive")
+	}
+
+	switch policy {
+	case OverflowBlock, OverflowDrop:
+	default:
+		return fmt.Errorf("unknown overflow policy: %s", policy)
+	}
+
+	c.output.bufferSize = size
+	c.output.policy = policy
+
+	return nil
+}
+
+// DroppedOutputLines returns how many output lines were dropped because the output buffer was full
+func (c *Composer) DroppedOutputLines() uint64 {
+	return atomic.LoadUint64(&c.output.totalDropped)
+}
+
+// start starts writing output in a separate goroutine
+func (m *outputMux) start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.entries = make(chan outputEntry, m.bufferSize)
+	m.done = make(chan struct{})
+
+	go m.run(m.entries, m.done)
+}
+
+// stop writes all buffered output and makes further output written directly
+func (m *outputMux) stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.entries == nil {
+		return
+	}
+
+	close(m.entries)
+	<-m.done
+
+	m.entries = nil
+	m.writeNotice()
+}
+
+// write queues the entry to be written, entries which can be dropped are dropped when the buffer is full
+func (m *outputMux) write(entry outputEntry, canDrop bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.entries == nil {
+		m.directLock.Lock()
+		m.writeBatch([]outputEntry{entry})
+		m.directLock.Unlock()
+		return
+	}
+
+	if !canDrop || m.policy != OverflowDrop {
+		m.entries <- entry
+		return
+	}
+
+	select {
+	case m.entries <- entry:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+		atomic.AddUint64(&m.totalDropped, 1)
+	}
+}
+
+func (m *outputMux) run(entries <-chan outputEntry, done chan<- struct{}) {
+	defer close(done)
+
+	batch := make([]outputEntry, 0, outputBatchSize)
+
+	for entry := range entries {
+		batch = append(batch[:0], entry)
+
+	collect:
+		for len(batch) < outputBatchSize {
+			select {
+			case entry, ok := <-entries:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, entry)
+			default:
+				break collect
+			}
+		}
+
+		m.writeNotice()
+		m.writeBatch(batch)
+	}
+}
+
+// writeNotice reports entries dropped since the last notice
+func (m *outputMux) writeNotice() {
+	if dropped := atomic.SwapUint64(&m.dropped, 0); dropped > 0 {
+		notice := m.notice(dropped)
+		_, _ = notice.writer.Write(notice.data)
+	}
+}
+
+// writeBatch writes consecutive entries for the same writer at once and delivers lines to sinks
+func (m *outputMux) writeBatch(batch []outputEntry) {
+	var buf bytes.Buffer
+	sinksWritten := false
+
+	for i, entry := range batch {
+		if entry.line != nil {
+			for _, sink := range m.sinks {
+				sink.WriteLine(*entry.line)
+			}
+			sinksWritten = true
+			continue
+		}
+
+		// lines already delivered to sinks must be written first
+		if sinksWritten {
+			m.flushSinks()
+			sinksWritten = false
+		}
+
+		buf.Write(entry.data)
+
+		if i == len(batch)-1 || batch[i+1].writer != entry.writer {
+			_, _ = entry.writer.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+
+	if sinksWritten {
+		m.flushSinks()
+	}
+}
+
+func (m *outputMux) flushSinks() {
+	for _, sink := range m.sinks {
+		if f, ok := sink.(flusher); ok {
+			_ = f.Flush()
+		}
+	}
+}
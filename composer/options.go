@@ -0,0 +1,137 @@
+package composer
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// Option configures Composer created by New
+type Option func(c *Composer) error
+
+// DefaultOpenFilesLimit defines a default limit of open files set for composer (and inherited by services)
+const DefaultOpenFilesLimit = 65000
+
+// WithStdout sets a writer of composer's messages and of stdout of services printed by the default sink
+// If not set, os.Stdout will be used.
+func WithStdout(w io.Writer) Option {
+	return func(c *Composer) error {
+		c.stdout = w
+		return nil
+	}
+}
+
+// WithStderr sets a writer of composer's errors and of stderr of services printed by the default sink
+// If not set, os.Stderr will be used.
+func WithStderr(w io.Writer) Option {
+	return func(c *Composer) error {
+		c.stderr = w
+		return nil
+	}
+}
+
+// WithDebug enables (or disables) debug logging (by default enabled when DEBUG environment variable is set)
+func WithDebug(enabled bool) Option {
+	return func(c *Composer) error {
+		c.debugEnabled = enabled
+		return nil
+	}
+}
+
+// WithSignals sets signals which interrupt composer (by default SIGINT, SIGHUP, SIGTERM and SIGQUIT).
+// When no signal is provided, composer doesn't handle signals at all, nor forwards them to services
+// (i.e. when it's used as a library).
+func WithSignals(signals ...os.Signal) Option {
+	return func(c *Composer) error {
+		c.signals = signals
+		return nil
+	}
+}
+
+// WithOpenFilesLimit sets a limit of open files raised before services are started
+// (it's clamped to the hard limit, unless composer is privileged to raise it).
+// When set to 0, the limit is not changed.
+func WithOpenFilesLimit(limit uint64) Option {
+	return func(c *Composer) error {
+		c.openFilesLimit = limit
+		return nil
+	}
+}
+
+// WithOutputSinks sets sinks receiving output lines of services (see SetOutputSinks)
+func WithOutputSinks(sinks ...OutputSink) Option {
+	return func(c *Composer) error {
+		c.SetOutputSinks(sinks...)
+		return nil
+	}
+}
+
+// WithOutputFormat sets how output is printed (see SetOutputFormat)
+func WithOutputFormat(format OutputFormat) Option {
+	return func(c *Composer) error {
+		return c.SetOutputFormat(format)
+	}
+}
+
+// WithOutputBuffer sets size of the output buffer and what happens when it's full (see SetOutputBuffer)
+func WithOutputBuffer(size int, policy OverflowPolicy) Option {
+	return func(c *Composer) error {
+		return c.SetOutputBuffer(size, policy)
+	}
+}
+
+// WithTimestamps makes composer prefix output lines of services with timestamps (see SetTimestamps)
+func WithTimestamps(mode TimestampMode, format string) Option {
+	return func(c *Composer) error {
+		return c.SetTimestamps(mode, format)
+	}
+}
+
+// WithMaxParallel limits how many services can be starting at the same time (see SetMaxParallel)
+func WithMaxParallel(n int) Option {
+	return func(c *Composer) error {
+		c.SetMaxParallel(n)
+		return nil
+	}
+}
+
+// WithParallelShutdown makes composer stop all services at once (see EnableParallelShutdown)
+func WithParallelShutdown() Option {
+	return func(c *Composer) error {
+		c.EnableParallelShutdown()
+		return nil
+	}
+}
+
+// WithControlSocket makes composer accept control requests on the Unix domain socket (see EnableControlSocket)
+func WithControlSocket(path string) Option {
+	return func(c *Composer) error {
+		c.EnableControlSocket(path)
+		return nil
+	}
+}
+
+// setOpenFilesLimit raises the soft limit of open files (and the hard limit, if it's permitted)
+func setOpenFilesLimit(n uint64) error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return err
+	}
+
+	if limit.Cur >= n {
+		return nil
+	}
+
+	if limit.Max < n {
+		// raising the hard limit requires privileges, otherwise the hard limit is used
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: n, Max: n}); err == nil {
+			return nil
+		}
+
+		n = limit.Max
+	}
+
+	limit.Cur = n
+
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+}
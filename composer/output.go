@@ -0,0 +1,259 @@
+package composer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// OutputFormat defines how output of services and composer's messages are printed
+type OutputFormat string
+
+const (
+	// OutputText prints service output prefixed by colored service names (default)
+	OutputText OutputFormat = "text"
+	// OutputJSON prints one JSON object per line for every output line and every composer message
+	OutputJSON OutputFormat = "json"
+)
+
+// TimestampMode defines which timestamps prefix output lines of services
+type TimestampMode string
+
+const (
+	// TimestampsNone disables timestamps (default)
+	TimestampsNone TimestampMode = ""
+	// TimestampsWall prefixes lines with the time of day
+	TimestampsWall TimestampMode = "wall"
+	// TimestampsElapsed prefixes lines with the time elapsed since composer started
+	TimestampsElapsed TimestampMode = "elapsed"
+)
+
+// DefaultTimestampFormat defines a default layout of timestamps (see time.Layout)
+const DefaultTimestampFormat = "15:04:05.000"
+
+// Levels of output records
+const (
+	levelOutput = "output"
+	levelDebug  = "debug"
+	levelInfo   = "info"
+	levelError  = "error"
+)
+
+// outputRecord defines a single line of JSON output
+type outputRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Service string    `json:"service,omitempty"`
+	// Stream is stdout or stderr (only for service's output lines)
+	Stream string `json:"stream,omitempty"`
+	Line   string `json:"line,omitempty"`
+	// Repeated defines how many times the previous line was repeated (when repeated lines are collapsed)
+	Repeated int `json:"repeated,omitempty"`
+	// Event is set for messages about lifecycle events of services
+	Event    EventType `json:"event,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// SetOutputFormat sets how output is printed (text by default)
+func (c *Composer) SetOutputFormat(format OutputFormat) error {
+	switch format {
+	case OutputText, OutputJSON:
+		c.outputFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// SetTimestamps makes composer prefix output lines of services with timestamps formatted with the layout
+// (see time.Layout, elapsed time is formatted as a time of day, i.e. 00:01:02.345 with the default layout).
+// When format is empty, DefaultTimestampFormat will be used.
+// JSON output always contains time of each line, so it's not affected.
+func (c *Composer) SetTimestamps(mode TimestampMode, format string) error {
+	switch mode {
+	case TimestampsNone, TimestampsWall, TimestampsElapsed:
+	default:
+		return fmt.Errorf("unknown timestamps mode: %s", mode)
+	}
+
+	if format == "" {
+		format = DefaultTimestampFormat
+	}
+
+	c.timestamps = mode
+	c.timestampFormat = format
+
+	return nil
+}
+
+// timestamp formats the time according to the timestamps mode
+func (c *Composer) timestamp(at time.Time) string {
+	switch c.timestamps {
+	case TimestampsWall:
+		return at.Format(c.timestampFormat)
+	case TimestampsElapsed:
+		return time.Time{}.Add(at.Sub(c.startedAt)).Format(c.timestampFormat)
+	default:
+		return ""
+	}
+}
+
+// print writes the record (when printing JSON) or the text to the writer
+func (c *Composer) print(record outputRecord, text string, writer io.Writer) {
+	c.output.write(c.format(record, text, writer), false)
+}
+
+// printEvent writes the record (when printing JSON) or the text to the writer and delivers the event to subscribers
+func (c *Composer) printEvent(event Event, record outputRecord, text string, writer io.Writer) {
+	event.Time = time.Now()
+	record.Time = event.Time
+
+	c.print(record, text, writer)
+	c.subscriptions.emit(event)
+}
+
+// format prepares an output entry with the record (when printing JSON) or the text
+func (c *Composer) format(record outputRecord, text string, writer io.Writer) outputEntry {
+	if c.outputFormat != OutputJSON {
+		return outputEntry{writer: writer, data: []byte(text + "\n")}
+	}
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(outputRecord{Time: record.Time, Level: levelError, Message: err.Error()})
+	}
+
+	return outputEntry{writer: c.stdoutWriter(), data: append(data, '\n')}
+}
+
+// droppedNotice returns an output entry reporting number of dropped output lines
+func (c *Composer) droppedNotice(dropped uint64) outputEntry {
+	msg := fmt.Sprintf("%d output lines dropped (output buffer is full)", dropped)
+
+	return c.format(outputRecord{Level: levelError, Message: msg}, "[composer] "+msg, c.stderrWriter())
+}
+
+// printLine delivers a line of the service's output read from the stream (stdout or stderr) to output sinks
+// and subscribers. Lines can be dropped from output when the output buffer is full (see OverflowDrop),
+// subscribers receive them regardless.
+func (c *Composer) printLine(service *Service, stream string, line string, at time.Time) {
+	outputLine := OutputLine{Service: service.name, Stream: stream, Line: line, Time: at}
+
+	c.subscriptions.emit(Event{Type: EventOutput, Service: service.name, Time: at, Line: outputLine})
+	c.output.write(outputEntry{line: &outputLine}, true)
+}
+
+// printRepeats delivers a summary of collapsed repeats of the previous line of the service's output to output sinks
+func (c *Composer) printRepeats(service *Service, stream string, repeated int, at time.Time) {
+	outputLine := OutputLine{Service: service.name, Stream: stream, Repeated: repeated, Time: at}
+
+	c.subscriptions.emit(Event{Type: EventOutput, Service: service.name, Time: at, Line: outputLine})
+	c.output.write(outputEntry{line: &outputLine}, true)
+}
+
+// linePrefix returns a prefix of the service's output line printed at the given time
+func (c *Composer) linePrefix(service *Service, at time.Time) string {
+	if c.timestamps == TimestampsNone {
+		return service.logPrefix + " "
+	}
+
+	return service.logPrefix + " " + c.timestamp(at) + " "
+}
+
+func (c *Composer) info(msg string, args ...interface{}) {
+	msg = fmt.Sprintf(msg, args...)
+
+	c.print(outputRecord{Level: levelInfo, Message: msg}, "[composer] "+msg, c.stdoutWriter())
+}
+
+// serviceInfo prints a composer message about the service (prefixed the same way as the service's output)
+func (c *Composer) serviceInfo(service *Service, msg string, args ...interface{}) {
+	msg = fmt.Sprintf(msg, args...)
+	record := outputRecord{Level: levelInfo, Service: service.name, Message: msg}
+
+	c.print(record, service.logPrefix+" [composer] "+msg, c.stdoutWriter())
+}
+
+// event prints a message about a lifecycle event of the service and delivers the event to subscribers
+func (c *Composer) event(service *Service, event EventType, msg string, args ...interface{}) {
+	msg = fmt.Sprintf(msg, args...)
+	record := outputRecord{Level: levelInfo, Service: service.name, Event: event, Message: msg}
+
+	c.printEvent(Event{Type: event, Service: service.name}, record, "[composer] "+msg, c.stdoutWriter())
+}
+
+// globalEvent prints a message about a lifecycle event of composer and delivers the event to subscribers
+func (c *Composer) globalEvent(event EventType, msg string) {
+	c.printEvent(Event{Type: event}, outputRecord{Level: levelInfo, Event: event, Message: msg}, "[composer] "+msg, c.stdoutWriter())
+}
+
+// readyEvent prints a message about the service being ready (or the task being completed).
+// Subscribers are notified by the service itself whenever it becomes ready (see Service.markReady).
+func (c *Composer) readyEvent(service *Service) {
+	msg := fmt.Sprintf("Service %s is ready", service.name)
+	if service.isTask {
+		msg = fmt.Sprintf("Task %s completed", service.name)
+	}
+
+	record := outputRecord{Level: levelInfo, Service: service.name, Event: EventReady, Message: msg}
+	c.print(record, "[composer] "+msg, c.stdoutWriter())
+}
+
+// exitEvent prints a message about the service's exit with err and delivers the event to subscribers
+func (c *Composer) exitEvent(service *Service, err error) {
+	exitCode := exitCode(err)
+	msg := fmt.Sprintf("Service %s %s", service.name, describeExit(err))
+	record := outputRecord{Level: levelInfo, Service: service.name, Event: EventExited, ExitCode: &exitCode, Message: msg}
+
+	event := Event{
+		Type:     EventExited,
+		Service:  service.name,
+		ExitCode: exitCode,
+		Err:      err,
+		Duration: time.Since(service.status().StartedAt),
+	}
+
+	c.printEvent(event, record, "[composer] "+msg, c.stdoutWriter())
+}
+
+func (c *Composer) debug(msg string, args ...interface{}) {
+	if !c.debugEnabled {
+		return
+	}
+
+	msg = fmt.Sprintf(msg, args...)
+
+	c.print(outputRecord{Level: levelDebug, Message: msg}, "[composer-debug] "+msg, c.stdoutWriter())
+}
+
+// error prints an error message (to stderr when printing text)
+func (c *Composer) error(msg string, args ...interface{}) {
+	msg = fmt.Sprintf(msg, args...)
+
+	c.print(outputRecord{Level: levelError, Message: msg}, msg, c.stderrWriter())
+}
+
+// stdoutWriter returns a writer of composer's output
+func (c *Composer) stdoutWriter() io.Writer {
+	if c.stdout != nil {
+		return c.stdout
+	}
+
+	return os.Stdout
+}
+
+// stderrWriter returns a writer of composer's errors
+func (c *Composer) stderrWriter() io.Writer {
+	if c.stderr != nil {
+		return c.stderr
+	}
+
+	return os.Stderr
+}
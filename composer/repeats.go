@@ -0,0 +1,62 @@
+package composer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// repeatFilter collapses consecutive repeated lines of output
+type repeatFilter struct {
+	mode     CollapseMode
+	lastLine string
+	hasLast  bool
+	repeats  int
+}
+
+func newRepeatFilter(mode CollapseMode) (*repeatFilter, error) {
+	switch mode {
+	case "":
+		mode = CollapseCaseInsensitive
+	case CollapseOff, CollapseExact, CollapseCaseInsensitive:
+	default:
+		return nil, fmt.Errorf("unknown collapse mode: %s", mode)
+	}
+
+	return &repeatFilter{mode: mode}, nil
+}
+
+// next returns whether the line should be printed
+// and how many times the previous line was repeated (since it was printed) before this line
+func (f *repeatFilter) next(line string) (bool, int) {
+	if f.hasLast && f.matches(line) {
+		f.repeats++
+		return false, 0
+	}
+
+	repeats := f.repeats
+
+	f.lastLine = line
+	f.hasLast = true
+	f.repeats = 0
+
+	return true, repeats
+}
+
+// flush returns how many times the last line was repeated since it was printed
+func (f *repeatFilter) flush() int {
+	repeats := f.repeats
+	f.repeats = 0
+
+	return repeats
+}
+
+func (f *repeatFilter) matches(line string) bool {
+	switch f.mode {
+	case CollapseExact:
+		return line == f.lastLine
+	case CollapseCaseInsensitive:
+		return strings.EqualFold(line, f.lastLine)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,134 @@
+package composer
+
+import (
+	"fmt"
+	"time"
+)
+
+type restartPolicy struct {
+	policy         RestartPolicy
+	maxRestarts    int
+	backoff        time.Duration
+	backoffMax     time.Duration
+	minUptime      time.Duration
+	crashLoopLimit int
+}
+
+func newRestartPolicy(cfg ServiceConfig) (*restartPolicy, error) {
+	p := &restartPolicy{
+		policy:         cfg.Restart,
+		maxRestarts:    cfg.MaxRestarts,
+		backoff:        cfg.RestartBackoff,
+		backoffMax:     cfg.RestartBackoffMax,
+		minUptime:      cfg.MinUptime,
+		crashLoopLimit: cfg.CrashLoopLimit,
+	}
+
+	switch p.policy {
+	case "":
+		p.policy = RestartNo
+	case RestartNo, RestartOnFailure, RestartAlways:
+	default:
+		return nil, fmt.Errorf("unknown restart policy: %s", p.policy)
+	}
+
+	if p.backoff == 0 {
+		p.backoff = DefaultRestartBackoff
+	}
+
+	if p.backoffMax == 0 {
+		p.backoffMax = DefaultRestartBackoffMax
+	}
+
+	if p.minUptime == 0 {
+		p.minUptime = DefaultMinUptime
+	}
+
+	if p.crashLoopLimit == 0 {
+		p.crashLoopLimit = DefaultCrashLoopLimit
+	}
+
+	return p, nil
+}
+
+// shouldRestart decides whether the service should be restarted after its command exited with err
+func (p *restartPolicy) shouldRestart(err error, restarts int) bool {
+	if p.maxRestarts > 0 && restarts >= p.maxRestarts {
+		return false
+	}
+
+	switch p.policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// exhausted returns whether the service isn't restarted after its command failed with err
+// only because it ran out of restarts
+func (p *restartPolicy) exhausted(err error, restarts int) bool {
+	return err != nil && p.policy != RestartNo && p.maxRestarts > 0 && restarts >= p.maxRestarts
+}
+
+// delay returns how long to wait before restarting a service which crashed given number of times in a row
+func (p *restartPolicy) delay(crashes int) time.Duration {
+	delay := p.backoff
+
+	for i := 1; i < crashes && delay < p.backoffMax; i++ {
+		delay *= 2
+	}
+
+	if delay > p.backoffMax {
+		delay = p.backoffMax
+	}
+
+	return delay
+}
+
+// nextRestart records the service's exit and returns a delay before it should be restarted.
+// When the service should not be restarted, ok is false.
+// When the service keeps crashing, an error is returned.
+func (s *Service) nextRestart(err error) (delay time.Duration, ok bool, crashErr error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.restartPolicy
+
+	if s.restartRequested {
+		s.restartRequested = false
+		s.restarts++
+		s.setState(StateRestarting)
+		return 0, true, nil
+	}
+
+	if !p.shouldRestart(err, s.restarts) {
+		return 0, false, nil
+	}
+
+	if time.Since(s.startedAt) < p.minUptime {
+		s.crashes++
+	} else {
+		s.crashes = 0
+	}
+
+	if s.crashes > p.crashLoopLimit {
+		return 0, false, fmt.Errorf("service %s is crash looping (%d crashes in a row): %w", s.name, s.crashes, err)
+	}
+
+	s.restarts++
+	s.setState(StateRestarting)
+
+	return p.delay(s.crashes), true, nil
+}
+
+// restartsExhausted returns whether the service isn't restarted after its command failed with err
+// only because it ran out of restarts
+func (s *Service) restartsExhausted(err error) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.restartPolicy.exhausted(err, s.restarts)
+}
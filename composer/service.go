@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -12,66 +14,488 @@ import (
 type Service struct {
 	id           int
 	isDependency bool
+	isTask       bool
+	// readyOnStart marks services without any ready condition (ready right after they are started)
+	readyOnStart bool
 	name         string
 	readyOn      string
+	readyOnRegex *regexp.Regexp
+	readyCheck   *readyCheck
+	liveness     *livenessCheck
 	workdir      string
 	command      string
 	dependsOn    []string
 	environment  map[string]string
 	killTimeout  time.Duration
+	readyTimeout time.Duration
+	stopSignal   syscall.Signal
+	hooks        serviceHooks
+
+	// forwardSignals are signals received by composer which are forwarded to the service's processes
+	forwardSignals []syscall.Signal
+
+	collapseRepeats CollapseMode
+
+	restartPolicy *restartPolicy
 
 	logPrefix string
+	output    *tail
+	// logFile receives raw output of the service (when log_file or log_dir is configured)
+	logFile *logFile
+	// events delivers events of the service to subscribers of composer
+	events *subscriptions
+
+	// exports holds variables captured by readyOnRegex (available to dependent services)
+	exports Environment
+	// imports holds variables exported by the service's dependencies
+	imports Environment
 
-	error     chan error
-	ready     chan bool
-	readyOnce sync.Once
-	cmd       *exec.Cmd
+	error chan error
+	// done is closed once the service exits and won't be restarted anymore
+	done chan struct{}
+	// finalErr is the error the service's supervisor finished with (set before done is closed)
+	finalErr error
+
+	// lock guards cmd, readiness and the state below, which change when the service restarts
+	lock          sync.Mutex
+	cmd           *exec.Cmd
+	outputWait    sync.WaitGroup
+	exited        chan struct{}
+	ready         chan bool
+	readyOnce     *sync.Once
+	readySignaled bool
+	state         ServiceState
+	changed       chan struct{}
+	startedAt     time.Time
+	readyAt       time.Time
+	lastExit      error
+	hasExited     bool
+	restarts      int
+	crashes       int
+	// restartRequested forces a restart after the next exit (regardless of the restart policy)
+	restartRequested bool
+	// stopRequested prevents a restart after the next exit, the service then waits for a start request
+	stopRequested bool
+	// awaitsRestart is set while the exited dependency can be restarted on request (see waitForRestartRequest)
+	awaitsRestart bool
+	// readyErr is set when the service is stopped because it didn't pass its ready check after a restart
+	readyErr      error
+	startRequests chan struct{}
 }
 
 func NewService(id int, name string, globalEnv Environment, cfg ServiceConfig) (*Service, error) {
 	service := &Service{
-		id:          id,
-		name:        name,
-		command:     cfg.Command,
-		workdir:     cfg.Workdir,
-		readyOn:     cfg.ReadyOn,
-		dependsOn:   cfg.DependsOn,
-		environment: cfg.Environment.Extends(globalEnv),
-		killTimeout: time.Duration(cfg.KillTimeout) * time.Second,
-		ready:       make(chan bool, 1),
-		error:       make(chan error, 1),
+		id:           id,
+		name:         name,
+		command:      cfg.Command,
+		workdir:      cfg.Workdir,
+		readyOn:      cfg.ReadyOn,
+		dependsOn:    cfg.DependsOn,
+		environment:  cfg.Environment.Extends(globalEnv),
+		readyTimeout: cfg.ReadyTimeout,
+		killTimeout:  time.Duration(cfg.KillTimeout) * time.Second,
+		stopSignal:   syscall.SIGINT,
+		output:       newTail(outputTailSize),
+		ready:        make(chan bool, 1),
+		readyOnce:    new(sync.Once),
+		state:        StatePending,
+		changed:      make(chan struct{}),
+		error:        make(chan error, 1),
+		done:         make(chan struct{}),
+
+		startRequests: make(chan struct{}, 1),
+		hooks: serviceHooks{
+			preStart:  cfg.PreStart,
+			postStart: cfg.PostStart,
+			onReady:   cfg.OnReady,
+			preStop:   cfg.PreStop,
+			postStop:  cfg.PostStop,
+			onFailure: cfg.OnFailure,
+		},
 	}
 
 	if service.killTimeout == 0 {
 		service.killTimeout = DefaultKillTimeout
 	}
 
-	if service.readyOn == "" {
+	var err error
+	if service.restartPolicy, err = newRestartPolicy(cfg); err != nil {
+		return nil, err
+	}
+
+	if _, err = newRepeatFilter(cfg.CollapseRepeats); err != nil {
+		return nil, fmt.Errorf("invalid collapse_repeats: %w", err)
+	}
+	service.collapseRepeats = cfg.CollapseRepeats
+
+	if cfg.StopSignal != "" {
+		if service.stopSignal, err = parseSignal(cfg.StopSignal); err != nil {
+			return nil, fmt.Errorf("invalid stop_signal: %w", err)
+		}
+	}
+
+	for _, name := range cfg.ForwardSignals {
+		sig, err := parseSignal(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward_signals: %w", err)
+		}
+
+		if sig == syscall.SIGKILL {
+			return nil, fmt.Errorf("invalid forward_signals: %s cannot be forwarded", name)
+		}
+
+		service.forwardSignals = append(service.forwardSignals, sig)
+	}
+
+	readyConditions := 0
+
+	if service.readyOn != "" {
+		readyConditions++
+	}
+
+	if cfg.ReadyOnRegex != "" {
+		if service.readyOnRegex, err = regexp.Compile(cfg.ReadyOnRegex); err != nil {
+			return nil, fmt.Errorf("invalid ready_on_regex: %w", err)
+		}
+		readyConditions++
+	}
+
+	if cfg.ReadyCheck != nil {
+		if service.readyCheck, err = newReadyCheck(service, cfg.ReadyCheck); err != nil {
+			return nil, fmt.Errorf("invalid ready_check: %w", err)
+		}
+		readyConditions++
+	}
+
+	if cfg.LivenessCheck != nil {
+		if service.liveness, err = newLivenessCheck(service, cfg.LivenessCheck); err != nil {
+			return nil, fmt.Errorf("invalid liveness_check: %w", err)
+		}
+	}
+
+	if readyConditions > 1 {
+		return nil, fmt.Errorf("only one of ready_on, ready_on_regex and ready_check can be used")
+	}
+
+	switch cfg.Type {
+	case "", ServiceTypeService:
+	case ServiceTypeTask:
+		// tasks are ready once they exit successfully
+		if readyConditions > 0 || service.liveness != nil {
+			return nil, fmt.Errorf("tasks cannot use ready_on, ready_on_regex, ready_check or liveness_check")
+		}
+
+		if service.restartPolicy.policy == RestartAlways {
+			return nil, fmt.Errorf("tasks cannot use restart policy %s", RestartAlways)
+		}
+
+		service.isTask = true
+	default:
+		return nil, fmt.Errorf("unknown service type: %s", cfg.Type)
+	}
+
+	if readyConditions == 0 && !service.isTask {
+		service.readyOnStart = true
 		service.ready <- true
+		service.readySignaled = true
 	}
 
 	return service, nil
 }
 
+// start starts the service's command (lock must be held by the caller)
+func (s *Service) start() error {
+	s.cmd.Env = s.environ(s.imports)
+
+	if err := s.cmd.Start(); err != nil {
+		return err
+	}
+
+	s.startedAt = time.Now()
+	s.readyAt = time.Time{}
+	s.exited = make(chan struct{})
+
+	if s.readyOnStart {
+		s.readyAt = s.startedAt
+		s.setState(StateReady)
+		s.emitReady()
+	} else {
+		s.setState(StateStarting)
+	}
+
+	return nil
+}
+
+// resetReady prepares readiness signalling for a new run of the service (lock must be held by the caller).
+// It returns false when the service wasn't ready yet, so the readiness of the previous run is still awaited.
+func (s *Service) resetReady() bool {
+	if !s.readySignaled {
+		return false
+	}
+
+	s.ready = make(chan bool, 1)
+	s.readyOnce = new(sync.Once)
+	s.readySignaled = false
+
+	if s.readyOnStart {
+		s.ready <- true
+		s.readySignaled = true
+	}
+
+	return true
+}
+
+// wait waits for the service's command to exit
+func (s *Service) wait() error {
+	s.lock.Lock()
+	cmd := s.cmd
+	s.lock.Unlock()
+
+	// we must first wait for command stdout / stderr because cmd.Wait() will close pipes after seeing the command exit
+	// see: https://pkg.go.dev/os/exec#Cmd.StdoutPipe
+	s.outputWait.Wait()
+
+	return cmd.Wait()
+}
+
+// takeStopRequest returns whether the last exit was requested by a stop request (and marks the service as stopped)
+func (s *Service) takeStopRequest() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.stopRequested {
+		return false
+	}
+
+	s.stopRequested = false
+	s.setState(StateStopped)
+
+	return true
+}
+
+// forwardsSignal returns whether the signal is forwarded to the service
+func (s *Service) forwardsSignal(sig os.Signal) bool {
+	for _, forwarded := range s.forwardSignals {
+		if forwarded == sig {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finish records the error the service's supervisor finished with and closes done
+func (s *Service) finish(err error) {
+	s.lock.Lock()
+	s.finalErr = err
+	s.lock.Unlock()
+
+	close(s.done)
+}
+
+// finalError returns the error the service's supervisor finished with (once done is closed)
+func (s *Service) finalError() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.finalErr
+}
+
+// takeReadyError returns an error of the ready check which stopped the service (if any)
+func (s *Service) takeReadyError() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.readyErr
+	s.readyErr = nil
+
+	return err
+}
+
+// exitRequested returns whether the service is expected to exit because of a stop or restart request
+func (s *Service) exitRequested() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stopRequested || s.restartRequested
+}
+
+// markReady signals that the service is ready (only the first call has an effect)
+// Provided exports will be available to dependent services.
+func (s *Service) markReady(exports Environment) {
+	s.lock.Lock()
+	once, ready := s.readyOnce, s.ready
+	s.lock.Unlock()
+
+	once.Do(func() {
+		s.lock.Lock()
+		s.exports = exports
+		s.readySignaled = true
+		if s.state == StateStarting {
+			s.readyAt = time.Now()
+			s.setState(StateReady)
+		}
+		s.lock.Unlock()
+
+		s.emitReady()
+		ready <- true
+	})
+}
+
+// emitReady notifies subscribers that the service became ready (or the task completed)
+func (s *Service) emitReady() {
+	if s.events != nil {
+		s.events.emit(Event{Type: EventReady, Service: s.name})
+	}
+}
+
+// readyChan returns a channel signalling readiness of the current run of the service
+func (s *Service) readyChan() <-chan bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.ready
+}
+
+// matchReadyOn checks whether the output line marks the service as ready
+func (s *Service) matchReadyOn(line string) {
+	if s.readyOn != "" && strings.Contains(line, s.readyOn) {
+		s.markReady(nil)
+	}
+
+	if s.readyOnRegex == nil {
+		return
+	}
+
+	match := s.readyOnRegex.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	exports := make(Environment)
+	for i, group := range s.readyOnRegex.SubexpNames() {
+		if group != "" {
+			exports[ExportName(s.name, group)] = match[i]
+		}
+	}
+
+	s.markReady(exports)
+}
+
+// ExportName returns the name of an environmental variable holding a value captured by
+// the named group of service's ready_on_regex, i.e. SERVICE_DB_PORT for service "db" and group "port".
+func ExportName(service, group string) string {
+	name := strings.ToUpper("SERVICE_" + service + "_" + group)
+
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
 func (s *Service) initCmd() error {
 	if len(s.command) == 0 {
 		return fmt.Errorf("command required")
 	}
 
-	s.cmd = exec.Command("/bin/sh", "-c", s.command)
+	// the environment is set when the command is started
+	s.cmd = s.shellCmd(s.command)
+
+	return nil
+}
+
+// newCmd prepares a shell command to be executed with the service's workdir and environment
+func (s *Service) newCmd(command string) *exec.Cmd {
+	cmd := s.shellCmd(command)
+	cmd.Env = s.env()
+
+	return cmd
+}
+
+// shellCmd prepares a shell command to be executed with the service's workdir
+func (s *Service) shellCmd(command string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", command)
 
 	// set pgid, so we can terminate all subprocesses as well
-	s.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	// set workdir
-	s.cmd.Dir = s.workdir
+	cmd.Dir = s.workdir
+
+	return cmd
+}
+
+// env returns environment variables of the service (including imports from its dependencies)
+func (s *Service) env() []string {
+	s.lock.Lock()
+	imports := s.imports
+	s.lock.Unlock()
+
+	return s.environ(imports)
+}
+
+// environ returns environment variables of the service with the imports from its dependencies.
+// The lock doesn't have to be held by the caller, imports are replaced as a whole (see importExports).
+func (s *Service) environ(imports Environment) []string {
+	// services without any environment inherit composer's own environment (nil environment of the command)
+	if len(s.environment) == 0 {
+		if len(imports) == 0 {
+			return nil
+		}
+
+		env := os.Environ()
+		for key, value := range imports {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+
+		return env
+	}
+
+	lookup := importLookup(imports)
+	env := make([]string, 0, len(imports)+len(s.environment))
+
+	for key, value := range imports {
+		if _, ok := s.environment[key]; !ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
 
-	// set environment variables
 	for key, value := range s.environment {
-		value = os.ExpandEnv(value)
-		env := fmt.Sprintf("%s=%s", key, value)
-		s.cmd.Env = append(s.cmd.Env, env)
+		value = os.Expand(value, lookup)
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	return nil
+	return env
+}
+
+// expand replaces ${var} or $var in the value according to the service's environment
+// (the same way as it's done for the service's command)
+func (s *Service) expand(value string) string {
+	s.lock.Lock()
+	imports := s.imports
+	s.lock.Unlock()
+
+	lookup := importLookup(imports)
+
+	return os.Expand(value, func(key string) string {
+		if value, ok := s.environment[key]; ok {
+			return os.Expand(value, lookup)
+		}
+
+		return lookup(key)
+	})
+}
+
+// importLookup returns a function looking up variables exported by service's dependencies
+// (or composer's own environment)
+func importLookup(imports Environment) func(string) string {
+	return func(key string) string {
+		if value, ok := imports[key]; ok {
+			return value
+		}
+
+		return os.Getenv(key)
+	}
 }
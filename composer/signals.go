@@ -0,0 +1,96 @@
+package composer
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var signalsByName = map[string]syscall.Signal{
+	"SIGHUP":   syscall.SIGHUP,
+	"SIGINT":   syscall.SIGINT,
+	"SIGQUIT":  syscall.SIGQUIT,
+	"SIGKILL":  syscall.SIGKILL,
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGTERM":  syscall.SIGTERM,
+	"SIGWINCH": syscall.SIGWINCH,
+}
+
+// parseSignal returns a signal by its name (i.e. SIGTERM, TERM or term)
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal, ok := signalsByName[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal: %s", name)
+	}
+
+	return signal, nil
+}
+
+// notifySignals starts relaying signals which interrupt composer and signals forwarded to services
+// (no signals are relayed when signal handling is disabled)
+func (c *Composer) notifySignals() chan os.Signal {
+	signalCh := make(chan os.Signal, 1)
+	if len(c.signals) == 0 {
+		return signalCh
+	}
+
+	signals := append([]os.Signal{}, c.signals...)
+	for _, service := range c.services {
+		for _, sig := range service.forwardSignals {
+			signals = append(signals, sig)
+		}
+	}
+
+	signal.Notify(signalCh, signals...)
+
+	return signalCh
+}
+
+// handleSignal forwards the signal to services which forward it, other signals interrupt composer
+func (c *Composer) handleSignal(sig os.Signal) {
+	forwarded := false
+
+	for _, service := range c.services {
+		if service.forwardsSignal(sig) {
+			forwarded = true
+			c.forwardSignal(service, sig.(syscall.Signal))
+		}
+	}
+
+	if !forwarded {
+		c.debug("received %v", sig)
+		c.Interrupt()
+	}
+}
+
+// forwardSignal sends the signal to all processes of the service (when it's running)
+func (c *Composer) forwardSignal(service *Service, sig syscall.Signal) {
+	service.lock.Lock()
+	cmd, exited := service.cmd, service.exited
+	service.lock.Unlock()
+
+	if cmd == nil || cmd.Process == nil {
+		c.debug("forward %v to %s - not started", sig, service.name)
+		return
+	}
+
+	select {
+	case <-exited:
+		c.debug("forward %v to %s - already exited", sig, service.name)
+		return
+	default:
+	}
+
+	c.debug("forward %v to %s (%d)", sig, service.name, cmd.Process.Pid)
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+		c.error("error forwarding %v to service %s with PID %d", sig, service.name, cmd.Process.Pid)
+	}
+}
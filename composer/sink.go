@@ -0,0 +1,193 @@
+package composer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Streams of services' output
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputLine defines a single line of a service's output
+type OutputLine struct {
+	Service string
+	// Stream is StreamStdout or StreamStderr
+	Stream string
+	Line   string
+	// Time when the line was read
+	Time time.Time
+	// Repeated is set (instead of Line) for a summary of collapsed repeats of the previous line (see CollapseMode)
+	Repeated int
+}
+
+// Text returns the line (or a summary of collapsed repeats)
+func (l OutputLine) Text() string {
+	if l.Repeated > 0 {
+		return fmt.Sprintf("(previous line repeated %dx)", l.Repeated)
+	}
+
+	return l.Line
+}
+
+// OutputSink receives output lines of services.
+// Lines are delivered one at a time (never concurrently), in order in which they were read.
+// When the sink implements Flush() error, it's called after each batch of lines.
+type OutputSink interface {
+	WriteLine(line OutputLine)
+}
+
+// flusher is implemented by sinks buffering their output
+type flusher interface {
+	Flush() error
+}
+
+// composerSink is implemented by sinks which format lines the same way as composer (i.e. use its prefixes)
+type composerSink interface {
+	attach(c *Composer)
+}
+
+// SetOutputSinks replaces sinks receiving output lines of services.
+// By default, lines are printed to stdout / stderr (see NewTerminalSink), or as JSON to stdout (see NewJSONSink).
+func (c *Composer) SetOutputSinks(sinks ...OutputSink) {
+	for _, sink := range sinks {
+		if s, ok := sink.(composerSink); ok {
+			s.attach(c)
+		}
+	}
+
+	c.output.sinks = sinks
+}
+
+// defaultSinks returns sinks used when no sinks are set
+func (c *Composer) defaultSinks() []OutputSink {
+	var sink OutputSink
+
+	if c.outputFormat == OutputJSON {
+		sink = NewJSONSink(c.stdoutWriter())
+	} else {
+		sink = NewTerminalSink(c.stdoutWriter(), c.stderrWriter())
+	}
+
+	if s, ok := sink.(composerSink); ok {
+		s.attach(c)
+	}
+
+	return []OutputSink{sink}
+}
+
+// terminalSink prints lines prefixed with colored service names (and timestamps, if enabled)
+type terminalSink struct {
+	c      *Composer
+	stdout *bufio.Writer
+	stderr *bufio.Writer
+}
+
+// NewTerminalSink returns a sink printing lines to stdout or stderr (according to their stream),
+// prefixed by colored service names.
+func NewTerminalSink(stdout, stderr io.Writer) OutputSink {
+	return &terminalSink{stdout: bufio.NewWriter(stdout), stderr: bufio.NewWriter(stderr)}
+}
+
+func (s *terminalSink) attach(c *Composer) {
+	s.c = c
+}
+
+func (s *terminalSink) WriteLine(line OutputLine) {
+	writer := s.stdout
+
+	if line.Stream == StreamStderr {
+		writer = s.stderr
+		// keep order of lines printed to both streams
+		_ = s.stdout.Flush()
+	} else {
+		_ = s.stderr.Flush()
+	}
+
+	prefix := "[" + line.Service + "] "
+	if service, err := s.c.findService(line.Service); err == nil {
+		prefix = s.c.linePrefix(service, line.Time)
+	}
+
+	_, _ = writer.WriteString(prefix + line.Text() + "\n")
+}
+
+func (s *terminalSink) Flush() error {
+	if err := s.stdout.Flush(); err != nil {
+		return err
+	}
+
+	return s.stderr.Flush()
+}
+
+// jsonSink writes one JSON object per line
+type jsonSink struct {
+	writer *bufio.Writer
+}
+
+// NewJSONSink returns a sink writing one JSON object per line (with time, service, stream and line fields)
+func NewJSONSink(w io.Writer) OutputSink {
+	return &jsonSink{writer: bufio.NewWriter(w)}
+}
+
+func (s *jsonSink) WriteLine(line OutputLine) {
+	data, err := json.Marshal(outputRecord{
+		Time:     line.Time,
+		Level:    levelOutput,
+		Service:  line.Service,
+		Stream:   line.Stream,
+		Line:     line.Line,
+		Repeated: line.Repeated,
+	})
+	if err != nil {
+		return
+	}
+
+	_, _ = s.writer.Write(append(data, '\n'))
+}
+
+func (s *jsonSink) Flush() error {
+	return s.writer.Flush()
+}
+
+// fileSink writes plain lines (without colors)
+type fileSink struct {
+	writer   *bufio.Writer
+	services map[string]bool
+}
+
+// NewFileSink returns a sink writing plain lines of the services (all services when none is provided) to w.
+// Lines are prefixed with service names, unless there's a single service.
+func NewFileSink(w io.Writer, services ...string) OutputSink {
+	s := &fileSink{writer: bufio.NewWriter(w)}
+
+	if len(services) > 0 {
+		s.services = make(map[string]bool, len(services))
+		for _, service := range services {
+			s.services[service] = true
+		}
+	}
+
+	return s
+}
+
+func (s *fileSink) WriteLine(line OutputLine) {
+	if s.services != nil && !s.services[line.Service] {
+		return
+	}
+
+	if len(s.services) != 1 {
+		_, _ = s.writer.WriteString("[" + line.Service + "] ")
+	}
+
+	_, _ = s.writer.WriteString(line.Text() + "\n")
+}
+
+func (s *fileSink) Flush() error {
+	return s.writer.Flush()
+}
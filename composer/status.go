@@ -0,0 +1,121 @@
+package composer
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// ServiceState defines a state of a service
+type ServiceState string
+
+const (
+	// StatePending marks a service which hasn't been started yet
+	StatePending ServiceState = "pending"
+	// StateStarting marks a running service which isn't ready yet (or a running task)
+	StateStarting ServiceState = "starting"
+	// StateReady marks a running service which is ready
+	StateReady ServiceState = "ready"
+	// StateExited marks a service which exited successfully or was stopped by composer
+	StateExited ServiceState = "exited"
+	// StateFailed marks a service which exited with an error
+	StateFailed ServiceState = "failed"
+	// StateRestarting marks a service waiting to be restarted
+	StateRestarting ServiceState = "restarting"
+	// StateStopped marks a service stopped on request (until it's requested to start again)
+	StateStopped ServiceState = "stopped"
+)
+
+// ServiceStatus describes the current state of a service
+type ServiceStatus struct {
+	Name  string       `json:"name"`
+	State ServiceState `json:"state"`
+	// PID of the service's process (only when the service is running)
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	ReadyAt   time.Time `json:"ready_at"`
+	Restarts  int       `json:"restarts"`
+	// ExitCode of the last exit of the service (-1 when killed by a signal), nil when the service hasn't exited yet
+	ExitCode *int `json:"exit_code,omitempty"`
+	// ExitError describes an error of the last exit of the service
+	ExitError string `json:"exit_error,omitempty"`
+}
+
+// IsRunning returns whether the service's process is running
+func (s ServiceStatus) IsRunning() bool {
+	return s.State == StateStarting || s.State == StateReady
+}
+
+func (s *Service) status() ServiceStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := ServiceStatus{
+		Name:      s.name,
+		State:     s.state,
+		StartedAt: s.startedAt,
+		ReadyAt:   s.readyAt,
+		Restarts:  s.restarts,
+	}
+
+	if status.IsRunning() {
+		status.PID = s.cmd.Process.Pid
+	}
+
+	if s.hasExited {
+		exitCode := exitCode(s.lastExit)
+		status.ExitCode = &exitCode
+
+		if s.lastExit != nil {
+			status.ExitError = s.lastExit.Error()
+		}
+	}
+
+	return status
+}
+
+// currentState returns the state of the service
+func (s *Service) currentState() ServiceState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.state
+}
+
+// setState changes the state of the service and notifies its watchers (lock must be held by the caller)
+func (s *Service) setState(state ServiceState) {
+	s.state = state
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// recordExit updates the state of the service which exited with err.
+// Expected exits (caused by composer) are never considered failures.
+func (s *Service) recordExit(err error, expected bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastExit = err
+	s.hasExited = true
+
+	if err == nil || expected {
+		s.setState(StateExited)
+	} else {
+		s.setState(StateFailed)
+	}
+}
+
+// exitCode returns the exit code of a command which finished with err (-1 when it was killed by a signal)
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
@@ -0,0 +1,52 @@
+package composer
+
+import "sync"
+
+// outputTailSize defines how many of the most recent output lines are kept for each service
+const outputTailSize = 100
+
+// tail keeps a limited number of the most recently added lines
+type tail struct {
+	lock  sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newTail(size int) *tail {
+	return &tail{lines: make([]string, size)}
+}
+
+func (t *tail) add(line string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// last returns up to n most recent lines (from the oldest to the newest)
+func (t *tail) last(n int) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	size := t.next
+	if t.full {
+		size = len(t.lines)
+	}
+
+	if n > size {
+		n = size
+	}
+
+	result := make([]string, 0, n)
+	for i := n; i > 0; i-- {
+		result = append(result, t.lines[(t.next-i+len(t.lines))%len(t.lines)])
+	}
+
+	return result
+}
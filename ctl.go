@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/t12y/composer/composer"
+)
+
+const ctlUsage = `
+Usage: %s ctl COMMAND [SERVICE]
+
+Commands:
+  status           show state of all services (same as: %[1]s ps)
+  restart SERVICE [-cascade]
+                   restart a service (or start a stopped one) and wait until it's ready,
+                   -cascade restarts also services depending on it
+  stop SERVICE     stop a service (other services keep running)
+  start SERVICE    start a stopped service
+  logs SERVICE [N] show last N output lines of a service
+
+`
+
+// ctl sends a command to the composer running in the current project and returns an exit code
+func ctl(cfg composer.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Printf(ctlUsage, os.Args[0])
+		return errCode
+	}
+
+	req := composer.ControlRequest{Command: args[0]}
+
+	if req.Command != composer.ControlStatus {
+		if len(args) < 2 {
+			fmt.Printf(ctlUsage, os.Args[0])
+			return errCode
+		}
+
+		req.Service = args[1]
+	}
+
+	if req.Command == composer.ControlRestart && len(args) > 2 {
+		if args[2] != "-cascade" {
+			fmt.Printf(ctlUsage, os.Args[0])
+			return errCode
+		}
+
+		req.Cascade = true
+	}
+
+	if req.Command == composer.ControlLogs && len(args) > 2 {
+		var err error
+		if req.Lines, err = strconv.Atoi(args[2]); err != nil {
+			fmt.Println("Invalid number of lines:", args[2])
+			return errCode
+		}
+	}
+
+	resp, err := composer.Control(composer.SocketPath(cfg), req)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return errCode
+	}
+
+	if resp.Error != "" {
+		fmt.Println("Error:", resp.Error)
+		return errCode
+	}
+
+	switch req.Command {
+	case composer.ControlStatus:
+		printStatus(resp.Services)
+	case composer.ControlLogs:
+		for _, line := range resp.Lines {
+			fmt.Println(line)
+		}
+	}
+
+	return 0
+}
+
+// printStatus prints a table of services' statuses ("-" marks values which are not available)
+func printStatus(services []composer.ServiceStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SERVICE\tSTATE\tPID\tUPTIME\tREADY AFTER\tRESTARTS\tEXIT")
+
+	for _, status := range services {
+		pid, uptime, readyAfter, exit := "-", "-", "-", "-"
+
+		if status.IsRunning() {
+			pid = strconv.Itoa(status.PID)
+			uptime = time.Since(status.StartedAt).Round(time.Second).String()
+
+			if !status.ReadyAt.IsZero() {
+				readyAfter = status.ReadyAt.Sub(status.StartedAt).Round(time.Millisecond).String()
+			}
+		}
+
+		if status.ExitCode != nil {
+			exit = strconv.Itoa(*status.ExitCode)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", status.Name, status.State, pid, uptime, readyAfter, status.Restarts, exit)
+	}
+
+	_ = w.Flush()
+}